@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/KyberNetwork/kutils"
+	"github.com/KyberNetwork/kutils/klog"
+)
+
+const (
+	defaultTokenType    = "Bearer"
+	defaultRefreshAhead = time.Minute
+)
+
+// Token is an access token to authenticate outgoing calls with.
+type Token struct {
+	AccessToken string
+	TokenType   string    // type of the token used as the authorization scheme, default Bearer
+	Expiry      time.Time // zero if the token never expires
+}
+
+// AuthorizationValue returns the value of the authorization header for the token.
+func (t *Token) AuthorizationValue() string {
+	tokenType := t.TokenType
+	if tokenType == "" {
+		tokenType = defaultTokenType
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+func (t *Token) expiresWithin(d time.Duration) bool {
+	return !t.Expiry.IsZero() && time.Until(t.Expiry) <= d
+}
+
+// Provider provides tokens to authenticate outgoing calls with.
+type Provider interface {
+	// Token returns a valid token, from cache unless it is expired or invalidated.
+	Token(ctx context.Context) (*Token, error)
+	// Invalidate drops token from cache after it was rejected by a server, so that the next Token call fetches a new
+	// one. It is a no-op if token is not the cached one anymore.
+	Invalidate(token *Token)
+}
+
+// Config configures the credentials of outgoing calls. Exactly one of Token, TokenFile and OAuth2 should be set.
+type Config struct {
+	Token          string        // static token
+	TokenFile      string        // file containing the token, reloaded when modified
+	FileCheckEvery time.Duration // interval to check TokenFile for modification, default 10s
+	OAuth2         *OAuth2Config // OAuth2 client credentials grant
+	TokenType      string        // type of Token and TokenFile tokens, default Bearer
+	AllowInsecure  bool          // allows sending grpc credentials over insecure connections
+}
+
+// Provider returns the token provider configured by c, or nil if none is configured.
+func (c *Config) Provider() Provider {
+	switch {
+	case c == nil:
+		return nil
+	case c.OAuth2 != nil:
+		return NewOAuth2Provider(c.OAuth2)
+	case c.TokenFile != "":
+		return NewFileProvider(c.TokenFile, c.TokenType, c.FileCheckEvery)
+	case c.Token != "":
+		return NewStaticProvider(&Token{AccessToken: c.Token, TokenType: c.TokenType})
+	default:
+		return nil
+	}
+}
+
+type staticProvider struct {
+	token *Token
+}
+
+// NewStaticProvider returns a Provider always returning token.
+func NewStaticProvider(token *Token) Provider {
+	return staticProvider{token: token}
+}
+
+func (p staticProvider) Token(context.Context) (*Token, error) {
+	return p.token, nil
+}
+
+func (staticProvider) Invalidate(*Token) {}
+
+// cachingProvider caches tokens from fetch until they are invalidated or about to expire. Tokens expiring within
+// refreshAhead are refreshed in the background while still being served.
+type cachingProvider struct {
+	name         string
+	fetch        func(ctx context.Context) (*Token, error)
+	refreshAhead time.Duration
+
+	mu         sync.Mutex
+	token      *Token
+	fetching   *fetchCall // in-flight fetch of callers without a valid token, nil if none
+	refreshing bool
+}
+
+// fetchCall is a fetch shared by concurrent callers.
+type fetchCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+func (p *cachingProvider) Token(ctx context.Context) (*Token, error) {
+	p.mu.Lock()
+	if token := p.token; token != nil && !token.expiresWithin(0) {
+		if token.expiresWithin(p.refreshAhead) && !p.refreshing && p.fetching == nil {
+			p.refreshing = true
+			go p.refresh(kutils.CtxWithoutCancel(ctx))
+		}
+		p.mu.Unlock()
+		return token, nil
+	}
+	call := p.fetching
+	if call == nil {
+		call = &fetchCall{done: make(chan struct{})}
+		p.fetching = call
+		go p.fetchToken(kutils.CtxWithoutCancel(ctx), call)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.token, call.err
+	}
+}
+
+// fetchToken fetches a token for the callers waiting on call.
+func (p *cachingProvider) fetchToken(ctx context.Context, call *fetchCall) {
+	call.token, call.err = p.fetch(ctx)
+	if call.err != nil {
+		klog.Errorf(ctx, "auth.cachingProvider|failed to fetch token|name=%s|err=%v", p.name, call.err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if call.err == nil {
+		p.token = call.token
+	}
+	p.fetching = nil
+	close(call.done)
+}
+
+// refresh fetches a token ahead of the cached one expiring, keeping the cached one on error.
+func (p *cachingProvider) refresh(ctx context.Context) {
+	token, err := p.fetch(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refreshing = false
+	if err != nil {
+		klog.Warnf(ctx, "auth.cachingProvider|failed to refresh token ahead of expiry|name=%s|err=%v", p.name, err)
+		return
+	}
+	p.token = token
+}
+
+func (p *cachingProvider) Invalidate(token *Token) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token == token {
+		p.token = nil
+	}
+}
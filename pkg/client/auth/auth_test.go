@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	var issued atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		if clientID != "id" || clientSecret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, issued.Add(1),
+			expiresIn)
+	}))
+	t.Cleanup(server.Close)
+	return server, &issued
+}
+
+func TestOAuth2Provider(t *testing.T) {
+	server, issued := newTokenServer(t, 3600)
+	provider := NewOAuth2Provider(&OAuth2Config{TokenURL: server.URL, ClientID: "id", ClientSecret: "secret"})
+	ctx := context.Background()
+
+	token, err := provider.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token-1", token.AuthorizationValue())
+	cached, err := provider.Token(ctx)
+	require.NoError(t, err)
+	assert.Same(t, token, cached)
+
+	provider.Invalidate(token)
+	token, err = provider.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken)
+	assert.Equal(t, int32(2), issued.Load())
+}
+
+func TestOAuth2ProviderRefreshAhead(t *testing.T) {
+	server, issued := newTokenServer(t, 30)
+	provider := NewOAuth2Provider(&OAuth2Config{TokenURL: server.URL, ClientID: "id", ClientSecret: "secret"})
+
+	token, err := provider.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken, "token expiring within RefreshAhead is still served")
+	_, _ = provider.Token(context.Background())
+	assert.Eventually(t, func() bool {
+		token, _ = provider.Token(context.Background())
+		return token.AccessToken != "token-1"
+	}, time.Second, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, issued.Load(), int32(2))
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("token-1\n"), 0o600))
+	provider := NewFileProvider(path, "", time.Millisecond)
+
+	token, err := provider.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+
+	require.NoError(t, os.WriteFile(path, []byte("token-2"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	time.Sleep(2 * time.Millisecond)
+	token, err = provider.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken)
+}
+
+func TestTransportRefreshesOnUnauthorized(t *testing.T) {
+	tokenServer, _ := newTokenServer(t, 3600)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider := NewOAuth2Provider(&OAuth2Config{TokenURL: tokenServer.URL, ClientID: "id", ClientSecret: "secret"})
+	httpClient := &http.Client{Transport: NewTransport(nil, provider)}
+	resp, err := httpClient.Post(server.URL, "text/plain", strings.NewReader("body"))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+}
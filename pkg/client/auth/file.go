@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultFileCheckEvery = 10 * time.Second
+
+// fileProvider reads the token from a file, such as a mounted secret, reloading it when the file is modified.
+type fileProvider struct {
+	path       string
+	tokenType  string
+	checkEvery time.Duration
+
+	mu        sync.Mutex
+	token     *Token
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewFileProvider returns a Provider reading the token from the file at path, checking every checkEvery for
+// modifications. The token is also reloaded when invalidated.
+func NewFileProvider(path, tokenType string, checkEvery time.Duration) Provider {
+	if checkEvery <= 0 {
+		checkEvery = defaultFileCheckEvery
+	}
+	return &fileProvider{path: path, tokenType: tokenType, checkEvery: checkEvery}
+}
+
+func (p *fileProvider) Token(context.Context) (*Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != nil && time.Since(p.checkedAt) < p.checkEvery {
+		return p.token, nil
+	}
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return p.cachedOr(errors.Wrapf(err, "stat token file %s", p.path))
+	}
+	p.checkedAt = time.Now()
+	if p.token != nil && info.ModTime().Equal(p.modTime) {
+		return p.token, nil
+	}
+	content, err := os.ReadFile(p.path)
+	if err != nil {
+		return p.cachedOr(errors.Wrapf(err, "read token file %s", p.path))
+	}
+	accessToken := strings.TrimSpace(string(content))
+	if accessToken == "" {
+		return p.cachedOr(errors.Errorf("token file %s is empty", p.path))
+	}
+	p.token = &Token{AccessToken: accessToken, TokenType: p.tokenType}
+	p.modTime = info.ModTime()
+	return p.token, nil
+}
+
+// cachedOr returns the cached token if any, or err otherwise.
+func (p *fileProvider) cachedOr(err error) (*Token, error) {
+	if p.token != nil {
+		return p.token, nil
+	}
+	return nil, err
+}
+
+func (p *fileProvider) Invalidate(token *Token) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token == token {
+		p.checkedAt = time.Time{}
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+const headerAuthorization = "authorization"
+
+// PerRPCCredentials implements credentials.PerRPCCredentials with tokens from a Provider.
+type PerRPCCredentials struct {
+	provider      Provider
+	allowInsecure bool
+}
+
+var _ credentials.PerRPCCredentials = (*PerRPCCredentials)(nil)
+
+// NewPerRPCCredentials returns grpc per-RPC credentials attaching tokens from provider. Unless allowInsecure, they
+// can only be used over secure connections.
+func NewPerRPCCredentials(provider Provider, allowInsecure bool) *PerRPCCredentials {
+	return &PerRPCCredentials{provider: provider, allowInsecure: allowInsecure}
+}
+
+// NewPerRPCCredentials returns grpc per-RPC credentials per c, or nil if no credentials are configured.
+func (c *Config) NewPerRPCCredentials() credentials.PerRPCCredentials {
+	provider := c.Provider()
+	if provider == nil {
+		return nil
+	}
+	return NewPerRPCCredentials(provider, c.AllowInsecure)
+}
+
+type tokenCtxKey struct{}
+
+// GetRequestMetadata returns the authorization header of the token chosen by UnaryClientInterceptor for the call, or
+// of the current token otherwise.
+func (c *PerRPCCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	token, ok := ctx.Value(tokenCtxKey{}).(*Token)
+	if !ok {
+		var err error
+		if token, err = c.provider.Token(ctx); err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "get token: %v", err)
+		}
+	}
+	return map[string]string{headerAuthorization: token.AuthorizationValue()}, nil
+}
+
+func (c *PerRPCCredentials) RequireTransportSecurity() bool {
+	return !c.allowInsecure
+}
+
+// UnaryClientInterceptor returns an interceptor that invalidates the token of calls failing with Unauthenticated and
+// retries them once with a fresh token.
+func (c *PerRPCCredentials) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		token, err := c.provider.Token(ctx)
+		if err != nil {
+			return status.Errorf(codes.Unauthenticated, "get token: %v", err)
+		}
+		err = invoker(context.WithValue(ctx, tokenCtxKey{}, token), method, req, reply, cc, opts...)
+		if status.Code(err) != codes.Unauthenticated {
+			return err
+		}
+		c.provider.Invalidate(token)
+		if token, err = c.provider.Token(ctx); err != nil {
+			return status.Errorf(codes.Unauthenticated, "get token: %v", err)
+		}
+		return invoker(context.WithValue(ctx, tokenCtxKey{}, token), method, req, reply, cc, opts...)
+	}
+}
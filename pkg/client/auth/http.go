@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"net/http"
+)
+
+// Transport is a http.RoundTripper setting the Authorization header of requests with tokens from a Provider. On 401
+// responses, it invalidates the token and retries once with a fresh token if the request body can be replayed.
+// Requests with an Authorization header already set are sent as is.
+type Transport struct {
+	Base     http.RoundTripper
+	Provider Provider
+}
+
+// NewTransport returns a Transport attaching tokens from provider to requests sent via base.
+func NewTransport(base http.RoundTripper, provider Provider) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base, Provider: provider}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(headerAuthorization) != "" {
+		return t.Base.RoundTrip(req)
+	}
+	token, err := t.Provider.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Base.RoundTrip(withAuthorization(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || req.Body != nil && req.GetBody == nil {
+		return resp, err
+	}
+
+	t.Provider.Invalidate(token)
+	if token, err = t.Provider.Token(req.Context()); err != nil {
+		return resp, nil //nolint:nilerr // keep the 401 response if no fresh token can be fetched
+	}
+	retryReq := withAuthorization(req, token)
+	if req.GetBody != nil {
+		if retryReq.Body, err = req.GetBody(); err != nil {
+			return resp, nil //nolint:nilerr // keep the 401 response if the body cannot be replayed
+		}
+	}
+	_ = resp.Body.Close()
+	return t.Base.RoundTrip(retryReq)
+}
+
+// withAuthorization returns a clone of req with the Authorization header of token, as RoundTrip must not modify req.
+func withAuthorization(req *http.Request, token *Token) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set(headerAuthorization, token.AuthorizationValue())
+	return req
+}
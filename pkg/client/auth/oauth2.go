@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultOAuth2Timeout = 10 * time.Second
+
+// OAuth2Config configures the OAuth2 client credentials grant (RFC 6749 section 4.4).
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	Params       map[string]string // additional token request parameters, e.g. audience
+	AuthInParams bool              // sends client credentials in the request body instead of basic auth
+	RefreshAhead time.Duration     // refreshes tokens this long before they expire, default 1m
+	Timeout      time.Duration     // timeout of token requests, default 10s
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// NewOAuth2Provider returns a Provider fetching tokens from cfg.TokenURL with the client credentials grant. Tokens are
+// cached until invalidated and refreshed in the background ahead of their expiry.
+func NewOAuth2Provider(cfg *OAuth2Config) Provider {
+	refreshAhead := cfg.RefreshAhead
+	if refreshAhead == 0 {
+		refreshAhead = defaultRefreshAhead
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultOAuth2Timeout
+	}
+	httpClient := &http.Client{Timeout: timeout}
+	return &cachingProvider{
+		name:         cfg.TokenURL,
+		refreshAhead: refreshAhead,
+		fetch: func(ctx context.Context) (*Token, error) {
+			return fetchClientCredentialsToken(ctx, httpClient, cfg)
+		},
+	}
+}
+
+func fetchClientCredentialsToken(ctx context.Context, httpClient *http.Client, cfg *OAuth2Config) (*Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(cfg.Scopes) != 0 {
+		form.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	for key, value := range cfg.Params {
+		form.Set(key, value)
+	}
+	if cfg.AuthInParams {
+		form.Set("client_id", cfg.ClientID)
+		form.Set("client_secret", cfg.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "create token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !cfg.AuthInParams {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	requestedAt := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request token")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrapf(err, "read token response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("token request failed with status %d: %s", resp.StatusCode, body)
+	}
+	var tokenResp tokenResponse
+	if err = json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, errors.Wrapf(err, "decode token response")
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+	token := &Token{AccessToken: tokenResp.AccessToken, TokenType: tokenResp.TokenType}
+	if strings.EqualFold(token.TokenType, defaultTokenType) {
+		token.TokenType = defaultTokenType
+	}
+	if tokenResp.ExpiresIn > 0 {
+		token.Expiry = requestedAt.Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
@@ -0,0 +1,320 @@
+package breaker
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+)
+
+// State is the state of a circuit breaker.
+type State int32
+
+const (
+	// StateClosed lets all calls through while recording their outcomes.
+	StateClosed State = iota
+	// StateOpen rejects all calls until OpenTimeout passes.
+	StateOpen
+	// StateHalfOpen lets HalfOpenCalls trial calls through to decide whether to close or reopen the circuit.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	defaultWindow               = 10 * time.Second
+	defaultBuckets              = 10
+	defaultMinCalls             = 20
+	defaultFailureRateThreshold = 0.5
+	defaultSlowCallDuration     = time.Second
+	defaultOpenTimeout          = 30 * time.Second
+	defaultHalfOpenCalls        = 5
+)
+
+// Config configures circuit breakers. The circuit opens when, over the rolling Window and with at least MinCalls
+// calls, the failure rate reaches FailureRateThreshold or the slow call rate reaches SlowCallThreshold.
+type Config struct {
+	Window               time.Duration // rolling window of call outcomes, default 10s
+	Buckets              int           // number of buckets the window rolls by, default 10
+	MinCalls             int           // min calls in the window before thresholds apply, default 20
+	FailureRateThreshold float64       // failure rate in (0, 1] to open the circuit, default 0.5
+	SlowCallThreshold    float64       // slow call rate in (0, 1] to open the circuit, default 0 (disabled)
+	SlowCallDuration     time.Duration // min duration of a slow call, default 1s
+	OpenTimeout          time.Duration // time to stay open before allowing trial calls, default 30s
+	HalfOpenCalls        int           // trial calls that must all succeed to close the circuit, default 5
+
+	// Methods overrides the config per method. Each overridden method gets its own circuit breaker while other methods
+	// share the target's one. Unset fields of an override default to the ones of this config.
+	Methods map[string]*Config
+}
+
+// merge returns c with unset fields defaulting to those of parent.
+func (c *Config) merge(parent *Config) *Config {
+	merged := *parent
+	merged.Methods = nil
+	if c.Window != 0 {
+		merged.Window = c.Window
+	}
+	if c.Buckets != 0 {
+		merged.Buckets = c.Buckets
+	}
+	if c.MinCalls != 0 {
+		merged.MinCalls = c.MinCalls
+	}
+	if c.FailureRateThreshold != 0 {
+		merged.FailureRateThreshold = c.FailureRateThreshold
+	}
+	if c.SlowCallThreshold != 0 {
+		merged.SlowCallThreshold = c.SlowCallThreshold
+	}
+	if c.SlowCallDuration != 0 {
+		merged.SlowCallDuration = c.SlowCallDuration
+	}
+	if c.OpenTimeout != 0 {
+		merged.OpenTimeout = c.OpenTimeout
+	}
+	if c.HalfOpenCalls != 0 {
+		merged.HalfOpenCalls = c.HalfOpenCalls
+	}
+	return &merged
+}
+
+var defaultConfig = Config{
+	Window:               defaultWindow,
+	Buckets:              defaultBuckets,
+	MinCalls:             defaultMinCalls,
+	FailureRateThreshold: defaultFailureRateThreshold,
+	SlowCallDuration:     defaultSlowCallDuration,
+	OpenTimeout:          defaultOpenTimeout,
+	HalfOpenCalls:        defaultHalfOpenCalls,
+}
+
+// Group holds the circuit breakers of a target: one shared by all methods, plus one per overridden method.
+type Group struct {
+	target   string
+	breaker  *Breaker
+	breakers map[string]*Breaker
+}
+
+// NewGroup creates the circuit breakers for a target per cfg.
+func NewGroup(target string, cfg *Config) *Group {
+	targetCfg := cfg.merge(&defaultConfig)
+	group := &Group{
+		target:   target,
+		breaker:  newBreaker(target, "", targetCfg),
+		breakers: make(map[string]*Breaker, len(cfg.Methods)),
+	}
+	for method, methodCfg := range cfg.Methods {
+		if methodCfg != nil {
+			group.breakers[method] = newBreaker(target, method, methodCfg.merge(targetCfg))
+		}
+	}
+	return group
+}
+
+// Get returns the circuit breaker for the given method.
+func (g *Group) Get(method string) *Breaker {
+	if breaker, ok := g.breakers[method]; ok {
+		return breaker
+	}
+	return g.breaker
+}
+
+// bucket counts call outcomes within a time slice of the rolling window.
+type bucket struct {
+	calls, failures, slowCalls int
+}
+
+// Breaker is a circuit breaker with closed, open and half-open states, opening on failure rate or slow call rate
+// over a rolling window.
+type Breaker struct {
+	target, method string
+	name           string
+	cfg            *Config
+	bucketDuration time.Duration
+
+	mu                sync.Mutex
+	state             State
+	generation        uint64 // incremented on each state change to ignore outcomes of calls from previous states
+	openedAt          time.Time
+	buckets           []bucket
+	bucketIdx         int
+	bucketStart       time.Time
+	halfOpenCalls     int // trial calls allowed so far in half-open state
+	halfOpenSuccesses int
+}
+
+func newBreaker(target, method string, cfg *Config) *Breaker {
+	buckets := max(cfg.Buckets, 1)
+	return &Breaker{
+		target:         target,
+		method:         method,
+		name:           strings.TrimSpace(target + " " + method),
+		cfg:            cfg,
+		bucketDuration: cfg.Window / time.Duration(buckets),
+		buckets:        make([]bucket, buckets),
+		bucketStart:    time.Now(),
+	}
+}
+
+// State returns the current state of the circuit breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshState(time.Now())
+	return b.state
+}
+
+// Outcome is the outcome of a call reported to a Breaker.
+type Outcome uint8
+
+const (
+	Success Outcome = iota
+	Failure
+	Ignored // neither a success nor a failure, such as a call cancelled by the caller
+)
+
+// Allow checks whether a call may proceed. If so, it returns a function to report the outcome of the call once it
+// finishes. Otherwise, it returns an Unavailable status error.
+func (b *Breaker) Allow() (done func(outcome Outcome), err error) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshState(now)
+	switch b.state {
+	case StateOpen:
+		return nil, status.Errorf(codes.Unavailable, "circuit breaker of %s is open", b.name)
+	case StateHalfOpen:
+		if b.halfOpenCalls >= b.cfg.HalfOpenCalls {
+			return nil, status.Errorf(codes.Unavailable, "circuit breaker of %s is half-open", b.name)
+		}
+		b.halfOpenCalls++
+	default:
+	}
+	generation := b.generation
+	return func(outcome Outcome) {
+		b.record(generation, outcome, time.Since(now))
+	}, nil
+}
+
+// refreshState moves an open circuit to half-open after OpenTimeout.
+func (b *Breaker) refreshState(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+func (b *Breaker) record(generation uint64, outcome Outcome, duration time.Duration) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	if outcome == Ignored {
+		if b.state == StateHalfOpen {
+			b.halfOpenCalls-- // frees the trial slot for another call
+		}
+		return
+	}
+	failed := outcome == Failure
+	slow := b.cfg.SlowCallThreshold > 0 && duration >= b.cfg.SlowCallDuration
+	switch b.state {
+	case StateHalfOpen:
+		if failed || slow {
+			b.setState(StateOpen, now)
+			return
+		}
+		if b.halfOpenSuccesses++; b.halfOpenSuccesses >= b.cfg.HalfOpenCalls {
+			b.setState(StateClosed, now)
+		}
+	case StateClosed:
+		b.rotate(now)
+		current := &b.buckets[b.bucketIdx]
+		current.calls++
+		if failed {
+			current.failures++
+		}
+		if slow {
+			current.slowCalls++
+		}
+		if b.shouldOpen() {
+			b.setState(StateOpen, now)
+		}
+	default:
+	}
+}
+
+// rotate advances the rolling window to now, resetting expired buckets.
+func (b *Breaker) rotate(now time.Time) {
+	if b.bucketDuration <= 0 {
+		return
+	}
+	n := int(now.Sub(b.bucketStart) / b.bucketDuration)
+	if n <= 0 {
+		return
+	}
+	if n >= len(b.buckets) {
+		clear(b.buckets)
+		b.bucketIdx, b.bucketStart = 0, now
+		return
+	}
+	for range n {
+		b.bucketIdx = (b.bucketIdx + 1) % len(b.buckets)
+		b.buckets[b.bucketIdx] = bucket{}
+	}
+	b.bucketStart = b.bucketStart.Add(time.Duration(n) * b.bucketDuration)
+}
+
+func (b *Breaker) shouldOpen() bool {
+	var total bucket
+	for _, bucket := range b.buckets {
+		total.calls += bucket.calls
+		total.failures += bucket.failures
+		total.slowCalls += bucket.slowCalls
+	}
+	if total.calls == 0 || total.calls < b.cfg.MinCalls {
+		return false
+	}
+	calls := float64(total.calls)
+	return float64(total.failures)/calls >= b.cfg.FailureRateThreshold ||
+		b.cfg.SlowCallThreshold > 0 && float64(total.slowCalls)/calls >= b.cfg.SlowCallThreshold
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.halfOpenCalls, b.halfOpenSuccesses = 0, 0
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		clear(b.buckets)
+		b.bucketStart = now
+	default:
+	}
+
+	ctx := context.Background()
+	klog.Warnf(ctx, "breaker.Breaker|circuit breaker state changed|target=%s|method=%s|from=%s|to=%s",
+		b.target, b.method, from, state)
+	kmetric.IncCircuitBreakerStateChange(ctx, kmetric.AttrTarget, b.target, kmetric.AttrMethod, b.method,
+		kmetric.AttrState, state.String())
+}
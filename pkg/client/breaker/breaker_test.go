@@ -0,0 +1,108 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func call(t *testing.T, b *Breaker, failed bool) {
+	done, err := b.Allow()
+	require.NoError(t, err)
+	if failed {
+		done(Failure)
+	} else {
+		done(Success)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	group := NewGroup("target", &Config{
+		MinCalls:      4,
+		OpenTimeout:   50 * time.Millisecond,
+		HalfOpenCalls: 2,
+	})
+	b := group.Get("/svc.Service/Get")
+
+	call(t, b, false)
+	call(t, b, false)
+	call(t, b, true)
+	assert.Equal(t, StateClosed, b.State())
+	call(t, b, true)
+	assert.Equal(t, StateOpen, b.State())
+
+	_, err := b.Allow()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done1, err := b.Allow()
+	require.NoError(t, err)
+	done2, err := b.Allow()
+	require.NoError(t, err)
+	_, err = b.Allow()
+	assert.Equal(t, codes.Unavailable, status.Code(err), "only HalfOpenCalls trial calls are allowed")
+
+	done1(Ignored)
+	assert.Equal(t, StateHalfOpen, b.State(), "ignored trial calls do not close the circuit")
+	done1, err = b.Allow()
+	require.NoError(t, err, "ignored trial calls free their slot")
+	done1(Success)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done2(Success)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerReopensOnFailedTrial(t *testing.T) {
+	b := NewGroup("target", &Config{MinCalls: 1, OpenTimeout: time.Millisecond}).Get("")
+	call(t, b, true)
+	assert.Equal(t, StateOpen, b.State())
+
+	time.Sleep(2 * time.Millisecond)
+	done, err := b.Allow()
+	require.NoError(t, err)
+	done(Failure)
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestBreakerSlowCalls(t *testing.T) {
+	b := NewGroup("target", &Config{
+		MinCalls:          2,
+		SlowCallThreshold: 0.5,
+		SlowCallDuration:  10 * time.Millisecond,
+	}).Get("")
+	call(t, b, false)
+	done, err := b.Allow()
+	require.NoError(t, err)
+	time.Sleep(15 * time.Millisecond)
+	done(Success)
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestBreakerWindowExpiry(t *testing.T) {
+	b := NewGroup("target", &Config{MinCalls: 2, Window: 20 * time.Millisecond, Buckets: 2}).Get("")
+	call(t, b, true)
+	time.Sleep(30 * time.Millisecond)
+	call(t, b, false)
+	assert.Equal(t, StateClosed, b.State(), "failure outside of window should not count")
+}
+
+func TestGroupMethodOverrides(t *testing.T) {
+	group := NewGroup("target", &Config{
+		MinCalls: 1,
+		Methods: map[string]*Config{
+			"/svc.Service/Slow": {MinCalls: 100},
+		},
+	})
+	assert.Same(t, group.Get("/svc.Service/A"), group.Get("/svc.Service/B"))
+	assert.NotSame(t, group.Get("/svc.Service/A"), group.Get("/svc.Service/Slow"))
+
+	call(t, group.Get("/svc.Service/Slow"), true)
+	assert.Equal(t, StateClosed, group.Get("/svc.Service/Slow").State())
+	call(t, group.Get("/svc.Service/A"), true)
+	assert.Equal(t, StateOpen, group.Get("/svc.Service/B").State())
+}
@@ -0,0 +1,44 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor returns a unary client interceptor failing calls fast with Unavailable while the circuit of
+// the group is open. Calls cancelled by the caller are not counted, while calls exceeding their deadline are failures,
+// as they are for a hanging server.
+func UnaryClientInterceptor(group *Group) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done, err := group.Get(method).Allow()
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled):
+			done(Ignored)
+		case IsGrpcFailure(err):
+			done(Failure)
+		default:
+			done(Success)
+		}
+		return err
+	}
+}
+
+// IsGrpcFailure checks whether err indicates that the server is failing, as opposed to client errors.
+func IsGrpcFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unknown, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unavailable,
+		codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
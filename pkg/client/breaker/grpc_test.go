@@ -0,0 +1,45 @@
+package breaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	group := NewGroup("target", &Config{MinCalls: 2, OpenTimeout: time.Minute})
+	interceptor := UnaryClientInterceptor(group)
+	invoke := func(ctx context.Context, code codes.Code) error {
+		return interceptor(ctx, "/svc.Service/Get", nil, nil, nil,
+			func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+				if code == codes.DeadlineExceeded { // hangs until the deadline
+					<-ctx.Done()
+					return status.FromContextError(ctx.Err()).Err()
+				}
+				return status.Error(code, "failed")
+			})
+	}
+
+	for range 3 {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, codes.Canceled, status.Code(invoke(ctx, codes.DeadlineExceeded)))
+		assert.Equal(t, codes.InvalidArgument, status.Code(invoke(context.Background(), codes.InvalidArgument)))
+	}
+	assert.Equal(t, StateClosed, group.Get("").State(), "cancelled calls and client errors are not failures")
+
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(invoke(ctx, codes.DeadlineExceeded)))
+		cancel()
+	}
+	assert.Equal(t, StateOpen, group.Get("").State(), "timeouts of a hanging server are failures")
+	err := invoke(context.Background(), codes.OK)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Contains(t, err.Error(), "circuit breaker")
+}
@@ -0,0 +1,59 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// Transport is an http.RoundTripper middleware failing requests fast with an Unavailable status error while the
+// circuit of the request's host is open. Circuits are per host, and per "METHOD /path" or "/path" for overrides.
+type Transport struct {
+	Base http.RoundTripper
+	Cfg  *Config
+
+	groups sync.Map // host -> *Group
+}
+
+// NewTransport wraps base with circuit breakers per cfg.
+func NewTransport(base http.RoundTripper, cfg *Config) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base, Cfg: cfg}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := t.breaker(req).Allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Base.RoundTrip(req)
+	switch {
+	case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+		done(Ignored) // the caller cancelling its request is not a failure of the host, unlike a timeout
+	case err != nil || IsHttpFailure(resp.StatusCode):
+		done(Failure)
+	default:
+		done(Success)
+	}
+	return resp, err
+}
+
+func (t *Transport) breaker(req *http.Request) *Breaker {
+	group, ok := t.groups.Load(req.URL.Host)
+	if !ok {
+		group, _ = t.groups.LoadOrStore(req.URL.Host, NewGroup(req.URL.Host, t.Cfg))
+	}
+	g := group.(*Group)
+	if breaker, ok := g.breakers[req.Method+" "+req.URL.Path]; ok {
+		return breaker
+	}
+	return g.Get(req.URL.Path)
+}
+
+// IsHttpFailure checks whether an http status code indicates that the server is failing or throttling.
+func IsHttpFailure(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,57 @@
+package breaker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hang":
+			<-r.Context().Done()
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	transport := NewTransport(nil, &Config{MinCalls: 2, OpenTimeout: time.Minute,
+		Methods: map[string]*Config{"GET /own": {MinCalls: 1}}})
+	client := &http.Client{Transport: transport}
+	get := func(ctx context.Context, path string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return err
+	}
+	req := httptest.NewRequest(http.MethodGet, server.URL, nil)
+
+	for range 3 {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		assert.ErrorIs(t, get(ctx, "/hang"), context.Canceled)
+		assert.NoError(t, get(context.Background(), "/missing"))
+	}
+	assert.Equal(t, StateClosed, transport.breaker(req).State(), "cancelled requests and 4xx are not failures")
+
+	client.Timeout = 10 * time.Millisecond
+	for range 3 {
+		assert.ErrorIs(t, get(context.Background(), "/hang"), context.DeadlineExceeded)
+	}
+	assert.Equal(t, StateOpen, transport.breaker(req).State(), "timeouts of a hanging server are failures")
+	client.Timeout = 0
+	err := get(context.Background(), "/missing")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.NoError(t, get(context.Background(), "/own"), "overridden paths have their own circuit")
+}
@@ -0,0 +1,253 @@
+// Package cassette provides an http.RoundTripper recording http interactions to cassette files and replaying them
+// deterministically, for tests against third-party http APIs to run offline.
+package cassette
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Mode is the mode of a cassette.
+type Mode string
+
+const (
+	ModeReplay         Mode = "replay"           // replays recorded interactions, failing unmatched requests
+	ModeRecord         Mode = "record"           // sends all requests, overwriting the cassette with new interactions
+	ModeReplayOrRecord Mode = "replay_or_record" // replays recorded interactions, sending and recording unmatched ones
+
+	// Scrubbed replaces scrubbed header values, query params and body matches in cassettes.
+	Scrubbed = "SCRUBBED"
+
+	bodyEncodingBase64 = "base64"
+)
+
+var (
+	// ErrNoInteraction is returned in replay mode for requests without a matching recorded interaction.
+	ErrNoInteraction = errors.New("no matching cassette interaction")
+
+	defaultScrubHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+	defaultScrubParams  = []string{"access_token", "api_key", "apikey", "key", "password", "secret", "signature",
+		"token"}
+)
+
+// Config configures a cassette. Requests match recorded interactions by method, url and body, after scrubbing and
+// ignoring the configured query params. Scrubbed values are compared as scrubbed, so secrets never need to be
+// recorded.
+type Config struct {
+	Path string // path of the cassette json file
+	Mode Mode   // default ModeReplay
+
+	MatchHeaders   []string // request headers that must also match
+	IgnoreParams   []string // query params ignored when matching, such as timestamps or nonces
+	IgnoreBody     bool     // whether to match requests regardless of their bodies
+	AllowRepeats   bool     // whether to replay interactions more than once, such as for polling
+	ScrubHeaders   []string // headers to scrub in addition to Authorization, Cookie, X-Api-Key and such
+	ScrubParams    []string // query params to scrub in addition to common credential ones such as token and api_key
+	ScrubBodyRegex []string // regexps of request and response body parts to scrub, such as "\"password\":\"[^\"]*\""
+}
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded http request.
+type Request struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"` // base64 for non-utf8 bodies
+}
+
+// Response is a recorded http response.
+type Response struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"` // base64 for non-utf8 bodies
+}
+
+// Load reads the cassette file at path.
+func Load(path string) (*Cassette, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cassette.Load|read %s", path)
+	}
+	var cassette Cassette
+	if err = json.Unmarshal(content, &cassette); err != nil {
+		return nil, errors.Wrapf(err, "cassette.Load|parse %s", path)
+	}
+	return &cassette, nil
+}
+
+// Save writes the cassette to the file at path, creating its directory if needed.
+func (c *Cassette) Save(path string) error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "cassette.Save|marshal %s", path)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrapf(err, "cassette.Save|mkdir %s", path)
+	}
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, append(content, '\n'), 0o644); err != nil {
+		return errors.Wrapf(err, "cassette.Save|write %s", path)
+	}
+	return errors.Wrapf(os.Rename(tmpPath, path), "cassette.Save|rename %s", path)
+}
+
+// scrubber scrubs and normalizes requests and responses per a Config.
+type scrubber struct {
+	matchHeaders []string
+	ignoreParams map[string]struct{}
+	ignoreBody   bool
+	scrubHeaders map[string]struct{}
+	scrubParams  map[string]struct{}
+	scrubBody    []*regexp.Regexp
+}
+
+func newScrubber(cfg *Config) (*scrubber, error) {
+	s := &scrubber{
+		ignoreParams: make(map[string]struct{}),
+		ignoreBody:   cfg.IgnoreBody,
+		scrubHeaders: make(map[string]struct{}),
+		scrubParams:  make(map[string]struct{}),
+	}
+	for _, header := range cfg.MatchHeaders {
+		s.matchHeaders = append(s.matchHeaders, http.CanonicalHeaderKey(header))
+	}
+	for _, param := range cfg.IgnoreParams {
+		s.ignoreParams[param] = struct{}{}
+	}
+	for _, header := range slices.Concat(defaultScrubHeaders, cfg.ScrubHeaders) {
+		s.scrubHeaders[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	for _, param := range slices.Concat(defaultScrubParams, cfg.ScrubParams) {
+		s.scrubParams[strings.ToLower(param)] = struct{}{}
+	}
+	for _, expr := range cfg.ScrubBodyRegex {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cassette|compile scrub body regex %s", expr)
+		}
+		s.scrubBody = append(s.scrubBody, re)
+	}
+	return s, nil
+}
+
+// request returns the scrubbed recording of an http request with the given body.
+func (s *scrubber) request(req *http.Request, body []byte) Request {
+	u := *req.URL
+	u.User = nil
+	if u.RawQuery != "" {
+		query := u.Query()
+		for param, values := range query {
+			if _, ok := s.scrubParams[strings.ToLower(param)]; ok {
+				for i := range values {
+					values[i] = Scrubbed
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	recorded := Request{Method: req.Method, URL: u.String(), Header: s.header(req.Header)}
+	recorded.Body, recorded.BodyEncoding = s.body(body)
+	return recorded
+}
+
+// response returns the scrubbed recording of an http response with the given body.
+func (s *scrubber) response(resp *http.Response, body []byte) Response {
+	recorded := Response{StatusCode: resp.StatusCode, Header: s.header(resp.Header)}
+	recorded.Body, recorded.BodyEncoding = s.body(body)
+	return recorded
+}
+
+func (s *scrubber) header(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	scrubbed := header.Clone()
+	for key, values := range scrubbed {
+		if _, ok := s.scrubHeaders[http.CanonicalHeaderKey(key)]; ok {
+			for i := range values {
+				values[i] = Scrubbed
+			}
+		}
+	}
+	return scrubbed
+}
+
+func (s *scrubber) body(body []byte) (string, string) {
+	for _, re := range s.scrubBody {
+		body = re.ReplaceAll(body, []byte(Scrubbed))
+	}
+	if !utf8.Valid(body) {
+		return base64.StdEncoding.EncodeToString(body), bodyEncodingBase64
+	}
+	return string(body), ""
+}
+
+// matches checks whether a scrubbed request matches a recorded one.
+func (s *scrubber) matches(req, recorded *Request) bool {
+	if req.Method != recorded.Method || s.matchUrl(req.URL) != s.matchUrl(recorded.URL) {
+		return false
+	}
+	if !s.ignoreBody && (req.Body != recorded.Body || req.BodyEncoding != recorded.BodyEncoding) {
+		return false
+	}
+	for _, header := range s.matchHeaders {
+		if !slices.Equal(req.Header.Values(header), recorded.Header.Values(header)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchUrl normalizes a recorded url for matching by removing ignored query params and sorting the others.
+func (s *scrubber) matchUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	query := u.Query()
+	for param := range s.ignoreParams {
+		query.Del(param)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// decodeBody decodes a recorded body.
+func decodeBody(body, encoding string) ([]byte, error) {
+	if encoding == bodyEncodingBase64 {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
+
+// readBody reads and closes body.
+func readBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil || body == http.NoBody {
+		return nil, nil
+	}
+	defer func() { _ = body.Close() }()
+	return io.ReadAll(body)
+}
@@ -0,0 +1,86 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		_, _ = w.Write([]byte(r.URL.Query().Get("q") + ":" + string(body)))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "testdata", "cassette.json")
+	cfg := &Config{Path: path, IgnoreParams: []string{"ts"}, ScrubBodyRegex: []string{`pass=\w+`}}
+
+	send := func(transport http.RoundTripper, query, body string) (string, error) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/search?api_key=secret&"+query,
+			strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		respBody, err := io.ReadAll(resp.Body)
+		return string(respBody), err
+	}
+
+	cfg.Mode = ModeRecord
+	recorder := NewTransport(nil, cfg)
+	body, err := send(recorder, "q=a&ts=1", "pass=123")
+	require.NoError(t, err)
+	assert.Equal(t, "a:pass=123", body)
+	_, err = send(recorder, "q=b&ts=1", "")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, calls.Load())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "secret", "credentials are scrubbed")
+	assert.NotContains(t, string(content), "123", "body is scrubbed")
+
+	cfg.Mode = ModeReplay
+	replayer := NewTransport(nil, cfg)
+	body, err = send(replayer, "q=b&ts=2", "")
+	require.NoError(t, err)
+	assert.Equal(t, "b:", body, "ignored params do not matter")
+	body, err = send(replayer, "ts=3&q=a", "pass=456")
+	require.NoError(t, err)
+	assert.Equal(t, "a:"+Scrubbed, body, "scrubbed body matches")
+	_, err = send(replayer, "q=a", "pass=456")
+	assert.True(t, errors.Is(err, ErrNoInteraction), "interactions are replayed once")
+	_, err = send(replayer, "q=c", "")
+	assert.True(t, errors.Is(err, ErrNoInteraction))
+	assert.EqualValues(t, 2, calls.Load(), "replay does not send requests")
+
+	cfg.Mode, cfg.AllowRepeats = ModeReplayOrRecord, true
+	replayer = NewTransport(nil, cfg)
+	for range 2 {
+		body, err = send(replayer, "q=b", "")
+		require.NoError(t, err)
+		assert.Equal(t, "b:", body)
+	}
+	body, err = send(replayer, "q=c", "")
+	require.NoError(t, err)
+	assert.Equal(t, "c:", body)
+	assert.EqualValues(t, 3, calls.Load(), "unmatched request is recorded")
+	cassette, err := Load(path)
+	require.NoError(t, err)
+	assert.Len(t, cassette.Interactions, 3)
+}
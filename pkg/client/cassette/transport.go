@@ -0,0 +1,151 @@
+package cassette
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Transport is an http.RoundTripper recording and replaying http interactions to and from a cassette file per Config.
+// The cassette is loaded lazily on the first request, and saved after each recorded interaction.
+type Transport struct {
+	Base http.RoundTripper
+	Cfg  *Config
+
+	loadOnce sync.Once
+	loadErr  error
+	scrubber *scrubber
+
+	mu       sync.Mutex
+	cassette *Cassette
+	replayed []bool // whether each interaction has been replayed
+}
+
+// NewTransport wraps base to record or replay its interactions per cfg.
+func NewTransport(base http.RoundTripper, cfg *Config) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base, Cfg: cfg}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	reqBody, err := readBody(req.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cassette|read request body %s %s", req.Method, req.URL)
+	}
+	req = req.Clone(req.Context())
+	if reqBody != nil {
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	recordedReq := t.scrubber.request(req, reqBody)
+	if t.Cfg.Mode != ModeRecord {
+		if resp, ok, err := t.replay(req, &recordedReq); ok || err != nil {
+			return resp, err
+		}
+		if t.Cfg.Mode != ModeReplayOrRecord {
+			return nil, errors.Wrapf(ErrNoInteraction, "cassette %s|%s %s", t.Cfg.Path, req.Method,
+				recordedReq.URL)
+		}
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cassette|read response body %s %s", req.Method, req.URL)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if err = t.record(&Interaction{Request: recordedReq, Response: t.scrubber.response(resp, respBody)}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// load loads the cassette file, which may be missing unless in ModeReplay.
+func (t *Transport) load() error {
+	t.loadOnce.Do(func() {
+		if t.scrubber, t.loadErr = newScrubber(t.Cfg); t.loadErr != nil {
+			return
+		}
+		t.cassette = &Cassette{}
+		if t.Cfg.Mode == ModeRecord {
+			return
+		}
+		cassette, err := Load(t.Cfg.Path)
+		if err != nil && (t.Cfg.Mode != ModeReplayOrRecord || !errors.Is(err, os.ErrNotExist)) {
+			t.loadErr = err
+			return
+		} else if err == nil {
+			t.cassette = cassette
+		}
+		t.replayed = make([]bool, len(t.cassette.Interactions))
+	})
+	return t.loadErr
+}
+
+// replay returns the response of the first matching interaction not yet replayed, or of the last matching one if
+// repeats are allowed.
+func (t *Transport) replay(req *http.Request, recordedReq *Request) (*http.Response, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	match := -1
+	for i, interaction := range t.cassette.Interactions {
+		if !t.scrubber.matches(recordedReq, &interaction.Request) {
+			continue
+		}
+		if !t.replayed[i] {
+			match = i
+			break
+		}
+		if t.Cfg.AllowRepeats {
+			match = i
+		}
+	}
+	if match < 0 {
+		return nil, false, nil
+	}
+	t.replayed[match] = true
+
+	recordedResp := t.cassette.Interactions[match].Response
+	body, err := decodeBody(recordedResp.Body, recordedResp.BodyEncoding)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "cassette %s|decode response body %s %s", t.Cfg.Path, req.Method,
+			recordedReq.URL)
+	}
+	header := recordedResp.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        strconv.Itoa(recordedResp.StatusCode) + " " + http.StatusText(recordedResp.StatusCode),
+		StatusCode:    recordedResp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, true, nil
+}
+
+// record appends interaction to the cassette and saves it.
+func (t *Transport) record(interaction *Interaction) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	t.replayed = append(t.replayed, true)
+	return t.cassette.Save(t.Cfg.Path)
+}
@@ -4,112 +4,336 @@ import (
 	"context"
 	"math/big"
 	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/KyberNetwork/kutils/klog"
 	"github.com/KyberNetwork/kyber-trace-go/pkg/tracer"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
-const EthCloseDelay = time.Minute
+const (
+	EthCloseDelay       = time.Minute
+	defaultEthRetention = 128
+)
 
-// EthCfg is hotcfg for eth client. It creates a client that automatically choose to use
-// the provided full node rpc or archive node.
+// EthCfg is hotcfg for eth client. It creates a client that automatically choose to use the provided full node rpc or
+// archive node, per the age of the block to read at behind the head block of the full node, fetched at most once per
+// HeadInterval. Each role may have multiple http(s) endpoints, balanced by health per Health and failed over on
+// transport or rate-limit errors. On update, the new client must answer eth_chainId within
+// Reload.ValidateTimeout to replace the previous one, which is closed once drained per Reload.
 type EthCfg struct {
-	Url        string
-	ArchiveUrl string
-	C          *EthClient
+	Url              string
+	ArchiveUrl       string
+	Endpoints        []EthEndpoint // full node endpoints in addition to Url
+	ArchiveEndpoints []EthEndpoint // archive node endpoints in addition to ArchiveUrl, default the full node ones
+	Health           EthHealthCfg
+	// PinLatest pins calls at the latest block to the head block of the full node tracked every HeadInterval, so that
+	// reads are consistent even when the head moves or differs between endpoints. BatchableEthClient pins each batch to
+	// a single block. Calls at a block that a lagging endpoint does not have yet fail over to other endpoints.
+	PinLatest    bool
+	HeadInterval time.Duration // default 1s
+	// Retention is the number of recent blocks whose state the full node retains, read from the full node instead of
+	// the archive node, default 128 like geth.
+	Retention uint64
+	Reload    ReloadCfg
+	C         *EthClient
 }
 
 func (*EthCfg) OnUpdate(old, new *EthCfg) {
 	ctx := context.Background()
-	if old != nil && old.C != nil {
-		oldC := old.C
-		time.AfterFunc(EthCloseDelay, func() {
-			oldC.Close()
-		})
+	if err := new.reload(ctx, "EthCfg", old); err != nil || old == nil || old.C == nil {
+		return
 	}
-	var err error
-	new.C, err = new.Dial(context.Background())
+	oldC := old.C
+	drain(ctx, old.name("EthCfg"), new.Reload.drainTimeout(EthCloseDelay), oldC.inFlightFunc(), func() error {
+		oldC.Close()
+		return nil
+	})
+}
+
+// reload dials the new client of c, validating it if old has a client. If that fails, c keeps the client of old.
+func (c *EthCfg) reload(ctx context.Context, kind string, old *EthCfg) error {
+	var oldC *EthClient
+	if old != nil {
+		oldC = old.C
+	}
+	ethClient, err := c.Dial(ctx)
+	if err == nil && oldC != nil {
+		if err = c.validate(ctx, ethClient); err != nil {
+			ethClient.Close()
+		}
+	}
+	recordReload(ctx, c.name(kind), err, old.name(kind))
 	if err != nil {
-		klog.Errorf(ctx, "EthCfg.OnUpdate|new.Dial failed: %v", err)
+		c.C = oldC
+		return err
+	}
+	c.C = ethClient
+	return nil
+}
+
+// validate checks that the rpc nodes of ethClient are reachable.
+func (c *EthCfg) validate(ctx context.Context, ethClient *EthClient) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Reload.validateTimeout())
+	defer cancel()
+	if _, err := ethClient.Client.ChainID(ctx); err != nil {
+		return errors.Wrapf(err, "EthCfg.validate %s", c.name("full node"))
+	}
+	if ethClient.Archive != ethClient.Client {
+		if _, err := ethClient.Archive.ChainID(ctx); err != nil {
+			return errors.Wrapf(err, "EthCfg.validate %s", c.name("archive node"))
+		}
+	}
+	return nil
+}
+
+func (c *EthCfg) name(kind string) string {
+	if c == nil {
+		return ""
+	}
+	if endpoints := c.endpoints(); len(endpoints) != 0 {
+		return kind + " " + endpoints[0].name()
+	}
+	return kind + " " + (&EthEndpoint{Url: c.ArchiveUrl}).name()
+}
+
+// endpoints returns the full node endpoints of c, starting with Url.
+func (c *EthCfg) endpoints() []EthEndpoint {
+	if c.Url == "" {
+		return c.Endpoints
+	}
+	return append([]EthEndpoint{{Url: c.Url}}, c.Endpoints...)
+}
+
+// archiveEndpoints returns the archive node endpoints of c, starting with ArchiveUrl.
+func (c *EthCfg) archiveEndpoints() []EthEndpoint {
+	if c.ArchiveUrl == "" {
+		return c.ArchiveEndpoints
 	}
+	return append([]EthEndpoint{{Url: c.ArchiveUrl}}, c.ArchiveEndpoints...)
 }
 
+// Dial connects to the full and archive nodes of c. A role without endpoints uses the other's client.
 func (c *EthCfg) Dial(ctx context.Context) (*EthClient, error) {
-	ethCli, err := Dial(ctx, c.Url)
-	if err != nil {
-		err = errors.Wrapf(err, "EthCfg.Dial %s", c.Url)
+	endpoints, archiveEndpoints := c.endpoints(), c.archiveEndpoints()
+	if len(endpoints) == 0 && len(archiveEndpoints) == 0 {
+		return nil, errors.New("EthCfg.Dial|no endpoints")
 	}
-	archiveEthCli, archiveErr := Dial(ctx, c.ArchiveUrl)
-	if archiveErr != nil {
-		archiveErr = errors.Wrapf(archiveErr, "EthCfg.Dial %s", c.ArchiveUrl)
+	inFlight := new(atomic.Int64)
+	ethClient := &EthClient{inFlight: inFlight}
+	var err error
+	if len(endpoints) != 0 {
+		if ethClient.Client, err = ethClient.dialRole(ctx, "full", endpoints, c.Health, inFlight); err != nil {
+			ethClient.Close()
+			return nil, err
+		}
 	}
-	if err != nil || ethCli == nil {
-		if archiveErr != nil || archiveEthCli == nil {
+	if len(archiveEndpoints) != 0 {
+		if ethClient.Archive, err = ethClient.dialRole(ctx, "archive", archiveEndpoints, c.Health,
+			inFlight); err != nil {
+			ethClient.Close()
 			return nil, err
 		}
-		ethCli = archiveEthCli
-	} else if archiveErr != nil || archiveEthCli == nil {
-		archiveEthCli = ethCli
+	}
+	if ethClient.Client == nil {
+		ethClient.Client = ethClient.Archive
+	} else if ethClient.Archive == nil {
+		ethClient.Archive = ethClient.Client
+	}
+	ethClient.pinLatest, ethClient.retention = c.PinLatest, c.Retention
+	if ethClient.retention == 0 {
+		ethClient.retention = defaultEthRetention
+	}
+	if c.PinLatest {
+		ethClient.head = newHeadTracker(ethClient.Client, c.HeadInterval)
+	} else if ethClient.Archive != ethClient.Client {
+		ethClient.head = newLazyHeadTracker(ethClient.Client, c.HeadInterval)
 	}
 
-	return &EthClient{Client: ethCli, Archive: archiveEthCli}, nil
+	for _, endpoint := range slices.Concat(endpoints, archiveEndpoints) {
+		if !isHttpUrl(endpoint.Url) {
+			ethClient.inFlight = nil
+		}
+	}
+	return ethClient, nil
 }
 
+// dialRole connects to the endpoints of a role, over an endpoint pool if there are several.
+func (c *EthClient) dialRole(ctx context.Context, role string, endpoints []EthEndpoint, health EthHealthCfg,
+	inFlight *atomic.Int64) (*ethclient.Client, error) {
+	if len(endpoints) == 1 {
+		ethCli, err := dial(ctx, role, endpoints[0], inFlight)
+		return ethCli, errors.Wrapf(err, "EthCfg.Dial %s", endpoints[0].name())
+	}
+	pool, err := newEthEndpointPool(role, endpoints, health, func(endpoint string) http.RoundTripper {
+		return newEthTransport(role, endpoint)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "EthCfg.Dial %s", role)
+	}
+	c.pools = append(c.pools, pool)
+	rpcClient, err := rpc.DialOptions(ctx, failoverUrl,
+		rpc.WithHTTPClient(&http.Client{Transport: &inFlightTransport{base: pool, inFlight: inFlight}}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "EthCfg.Dial %s", role)
+	}
+	return ethclient.NewClient(rpcClient), nil
+}
+
+// Dial connects to an eth rpc node. Http(s) rpc calls are instrumented for metrics and tracing.
 func Dial(ctx context.Context, url string) (*ethclient.Client, error) {
-	if tracer.Provider() == nil {
+	return dial(ctx, "", EthEndpoint{Url: url}, nil)
+}
+
+// dial connects to an eth rpc node of a role, counting in-flight http(s) rpc calls in inFlight if not nil.
+func dial(ctx context.Context, role string, endpoint EthEndpoint, inFlight *atomic.Int64) (*ethclient.Client,
+	error) {
+	url := endpoint.Url
+	if !isHttpUrl(url) {
 		return ethclient.DialContext(ctx, url)
 	}
-	rpcClient, err := rpc.DialOptions(ctx, url,
-		rpc.WithHTTPClient(&http.Client{Transport: otelhttp.NewTransport(nil)}))
+	transport := newEthTransport(role, endpoint.name())
+	if inFlight != nil {
+		transport = &inFlightTransport{base: transport, inFlight: inFlight}
+	}
+	rpcClient, err := rpc.DialOptions(ctx, url, rpc.WithHTTPClient(&http.Client{Transport: transport}))
 	if err != nil {
 		return nil, err
 	}
 	return ethclient.NewClient(rpcClient), nil
 }
 
+// newEthTransport returns the http transport of eth rpc calls to an endpoint of a role, instrumented for metrics per
+// json-rpc call and for tracing.
+func newEthTransport(role, endpoint string) http.RoundTripper {
+	transport := http.DefaultTransport
+	if tracer.Provider() != nil {
+		transport = otelhttp.NewTransport(transport)
+	}
+	return newJsonRpcMetricsTransport(transport, role, endpoint)
+}
+
+func isHttpUrl(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
 type EthClient struct {
 	*ethclient.Client
 	Archive *ethclient.Client
+
+	inFlight *atomic.Int64      // in-flight rpc calls, nil if they cannot all be counted
+	pools    []*ethEndpointPool // endpoint pools of roles with several endpoints
+	head     *headTracker       // head block tracker if pinning latest calls or routing by block age
+
+	pinLatest bool   // whether to pin calls at the latest block to the tracked head block
+	retention uint64 // number of recent blocks whose state the full node retains
 }
 
 func (c *EthClient) Close() {
-	c.Client.Close()
-	c.Archive.Close()
+	if c == nil {
+		return
+	}
+	if c.Client != nil {
+		c.Client.Close()
+	}
+	if c.Archive != nil {
+		c.Archive.Close()
+	}
+	for _, pool := range c.pools {
+		pool.Close()
+	}
+	c.head.Close()
+}
+
+// inFlightFunc returns a function returning the number of in-flight rpc calls, or nil if they cannot all be counted,
+// e.g. over websocket.
+func (c *EthClient) inFlightFunc() func() int64 {
+	if c == nil || c.inFlight == nil {
+		return nil
+	}
+	return c.inFlight.Load
 }
 
+// ClientFor returns the client to read at blockNumber: the full node for the latest block, block tags other than
+// earliest and blocks within the retention of the full node behind the tracked head, or else the archive node. Unless
+// pinning latest calls, the head block is only fetched by the reads of c, routing to the archive node until then.
 func (c *EthClient) ClientFor(blockNumber *big.Int) *ethclient.Client {
 	if blockNumber == nil {
 		return c.Client
 	}
-	return c.Archive
+	if blockNumber.Sign() < 0 {
+		if blockNumber.Cmp(big.NewInt(int64(rpc.EarliestBlockNumber))) == 0 {
+			return c.Archive
+		}
+		return c.Client
+	}
+	head := c.head.get()
+	if head == nil || new(big.Int).Sub(head, blockNumber).Cmp(new(big.Int).SetUint64(c.retention)) >= 0 {
+		return c.Archive
+	}
+	return c.Client
+}
+
+// readAt reads at blockNumber with the client for it, retrying with the archive node if the full node misses the
+// state at blockNumber.
+func readAt[T any](ctx context.Context, c *EthClient, blockNumber *big.Int,
+	read func(client *ethclient.Client, blockNumber *big.Int) (T, error)) (T, error) {
+	client, blockNumber := c.at(ctx, blockNumber)
+	result, err := read(client, blockNumber)
+	if err != nil && client != c.Archive && isMissingState(err) {
+		return read(c.Archive, blockNumber)
+	}
+	return result, err
+}
+
+// isMissingState checks whether err is due to a full node missing the state at a block.
+func isMissingState(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "missing trie node")
 }
 
 func (c *EthClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
-	return c.ClientFor(blockNumber).BalanceAt(ctx, account, blockNumber)
+	return readAt(ctx, c, blockNumber, func(client *ethclient.Client, blockNumber *big.Int) (*big.Int, error) {
+		return client.BalanceAt(ctx, account, blockNumber)
+	})
 }
 
 func (c *EthClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
-	return c.ClientFor(blockNumber).CodeAt(ctx, account, blockNumber)
+	return readAt(ctx, c, blockNumber, func(client *ethclient.Client, blockNumber *big.Int) ([]byte, error) {
+		return client.CodeAt(ctx, account, blockNumber)
+	})
 }
 
 func (c *EthClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
-	return c.ClientFor(blockNumber).NonceAt(ctx, account, blockNumber)
+	return readAt(ctx, c, blockNumber, func(client *ethclient.Client, blockNumber *big.Int) (uint64, error) {
+		return client.NonceAt(ctx, account, blockNumber)
+	})
 }
 
 func (c *EthClient) StorageAt(ctx context.Context, account common.Address, key common.Hash,
 	blockNumber *big.Int) ([]byte, error) {
-	return c.ClientFor(blockNumber).StorageAt(ctx, account, key, blockNumber)
+	return readAt(ctx, c, blockNumber, func(client *ethclient.Client, blockNumber *big.Int) ([]byte, error) {
+		return client.StorageAt(ctx, account, key, blockNumber)
+	})
 }
 
 func (c *EthClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
-	return c.ClientFor(blockNumber).CallContract(ctx, call, blockNumber)
+	return readAt(ctx, c, blockNumber, func(client *ethclient.Client, blockNumber *big.Int) ([]byte, error) {
+		return client.CallContract(ctx, call, blockNumber)
+	})
+}
+
+func (c *EthClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return readAt(ctx, c, number, func(client *ethclient.Client, number *big.Int) (*types.Header, error) {
+		return client.HeaderByNumber(ctx, number)
+	})
 }
 
 func (c *EthClient) BatchCallContext(ctx context.Context, batch []rpc.BatchElem) error {
@@ -3,80 +3,313 @@ package client
 import (
 	"context"
 	"math/big"
+	"sync/atomic"
 	"time"
 
 	"github.com/KyberNetwork/kutils"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
 )
 
+// codeMissingState is the code attribute of calls retried on the archive node for missing state on the full node.
+const codeMissingState = "missing_state"
+
+// ethTracer traces batched eth calls.
+var ethTracer = otel.Tracer("github.com/KyberNetwork/service-framework/pkg/client")
+
 // BatchableEthCfg is hotcfg for batchable eth client.
-// It batches eth_call's up to be sent together within 1 request to the rpc node.
+// It batches eth_call's and other state and block queries up to be sent together within 1 request to the rpc node.
+// The client is reloaded like EthCfg's, keeping the previous client if the new one fails validation.
 type BatchableEthCfg struct {
 	EthCfg    `mapstructure:",squash"`
 	BatchRate time.Duration
 	BatchCnt  int
 	BackOff   *BackoffCfg
-	C         *BatchableEthClient
+	// Multicall aggregates batched eth_call's into Multicall3 aggregate3 calls, see WithMulticall.
+	Multicall        bool
+	MulticallAddress string       // default Multicall3Address
+	Cache            *EthCacheCfg // caches results at final blocks if set, see WithCache
+	C                *BatchableEthClient
+}
+
+// multicallAddress returns the Multicall3 address to aggregate calls with, or nil if disabled.
+func (c *BatchableEthCfg) multicallAddress() *common.Address {
+	if !c.Multicall {
+		return nil
+	}
+	if c.MulticallAddress == "" {
+		return &Multicall3Address
+	}
+	address := common.HexToAddress(c.MulticallAddress)
+	return &address
 }
 
 func (*BatchableEthCfg) OnUpdate(old, new *BatchableEthCfg) {
-	if old == nil {
-		new.EthCfg.OnUpdate(nil, &new.EthCfg)
-		new.BackOff.OnUpdate(nil, new.BackOff)
-	} else {
-		new.EthCfg.OnUpdate(&old.EthCfg, &new.EthCfg)
-		new.BackOff.OnUpdate(old.BackOff, new.BackOff)
+	ctx := context.Background()
+	var oldEthCfg *EthCfg
+	var oldBackOff *BackoffCfg
+	var oldCache *EthCacheCfg
+	var oldC *BatchableEthClient
+	if old != nil {
+		oldEthCfg, oldBackOff, oldCache, oldC = &old.EthCfg, old.BackOff, old.Cache, old.C
 	}
-	if old != nil && old.C != nil {
-		oldC := old.C
-		time.AfterFunc(EthCloseDelay, func() {
-			oldC.Close()
-		})
+	new.BackOff.OnUpdate(oldBackOff, new.BackOff)
+	if err := new.EthCfg.reload(ctx, "BatchableEthCfg", oldEthCfg); err != nil {
+		if oldC != nil {
+			new.C = oldC
+			new.Cache.keep(oldCache)
+		}
+		return
+	}
+	new.Cache.onUpdate(oldCache)
+
+	var opts []BatchableEthOption
+	if address := new.multicallAddress(); address != nil {
+		opts = append(opts, WithMulticall(*address))
+	}
+	if new.Cache != nil {
+		opts = append(opts, WithCache(new.Cache))
 	}
 	new.C = NewBatchableEthClient(new.EthCfg.C, func() (time.Duration, int) {
 		return new.BatchRate, new.BatchCnt
-	}, new.BackOff.BackOff)
+	}, new.BackOff.BackOff, opts...)
+	if oldC != nil {
+		drain(ctx, oldEthCfg.name("BatchableEthCfg"), new.Reload.drainTimeout(EthCloseDelay), oldC.inFlightFunc(),
+			func() error {
+				oldC.Close()
+				return nil
+			})
+	}
 }
 
 type BatchableEthClient struct {
 	*EthClient
-	batcher        kutils.Batcher[*CallMsg, []byte]
-	archiveBatcher kutils.Batcher[*CallMsg, []byte]
+	batcher        kutils.Batcher[*ethTask, any]
+	archiveBatcher kutils.Batcher[*ethTask, any]
 	backOff        backoff.BackOff
+	inFlight       atomic.Int64 // calls queued or being sent
+
+	multicallAddress *common.Address // Multicall3 address to aggregate calls with, nil if disabled
+	multicallMissing atomic.Bool     // whether Multicall3 turned out not to be deployed at the latest block
+	cache            *ethCache       // cache of results at final blocks, nil if disabled
 }
 
+// CallMsg is an eth_call task queued in a batch.
+//
+// Deprecated: BatchableEthClient batches any json-rpc call with its own task type and no longer uses CallMsg, which is
+// kept for compatibility only.
 type CallMsg struct {
 	ethereum.CallMsg
 	BlockNumber *big.Int
 	*kutils.ChanTask[[]byte]
 }
 
-func NewBatchableEthClient(client *EthClient, batchCfg kutils.BatchCfg, backOff backoff.BackOff) *BatchableEthClient {
+// BatchableEthOption configures a BatchableEthClient.
+type BatchableEthOption func(*BatchableEthClient)
+
+// WithMulticall aggregates the eth_call's of each batch at the same block into a single Multicall3 aggregate3 call to
+// address, allowing each call to fail. Calls that Multicall3 cannot represent, i.e. with a sender, value, gas or fee
+// fields, are sent on their own in the same json-rpc batch. Aggregated calls fall back to being sent on their own if
+// the aggregate3 call fails, such as when Multicall3 is not deployed at the block. Note that aggregated calls are sent
+// from the Multicall3 contract, so they must not depend on msg.sender. Reverted calls fail with a *RevertError.
+func WithMulticall(address common.Address) BatchableEthOption {
+	return func(b *BatchableEthClient) {
+		b.multicallAddress = &address
+	}
+}
+
+// WithCache caches the results of calls at blocks with at least cfg.Confirmations confirmations, including calls at
+// the latest block pinned to such a block per ctx. Transaction receipts and calls at block tags are never cached.
+func WithCache(cfg *EthCacheCfg) BatchableEthOption {
+	return func(b *BatchableEthClient) {
+		b.cache = cfg.get()
+	}
+}
+
+// ethTask is a json-rpc call queued in a batch, resolved with its result pointer once decoded.
+type ethTask struct {
+	*kutils.ChanTask[any]
+	method   string
+	args     []any
+	result   any               // pointer to decode the result into
+	archive  bool              // whether to send the call to the archive node
+	blockArg int               // index of the block number in args, -1 if none
+	callMsg  *ethereum.CallMsg // message of an eth_call, which may be aggregated by Multicall3
+	queuedAt time.Time
+	sentAt   time.Time // zero if not sent
+}
+
+// role returns the node role of the call of t.
+func (t *ethTask) role() string {
+	if t.archive {
+		return "archive"
+	}
+	return "full"
+}
+
+// Resolve resolves t, recording its outcome and queue wait in metrics and its span.
+func (t *ethTask) Resolve(ret any, err error) {
+	ctx, wait := t.Ctx(), time.Since(t.queuedAt)
+	if !t.sentAt.IsZero() {
+		wait = t.sentAt.Sub(t.queuedAt)
+	}
+	kmetric.RecordEthBatchCall(ctx, wait, kmetric.AttrRole, t.role(), kmetric.AttrMethod, t.method,
+		kmetric.AttrCode, rpcErrorCode(err))
+	if err != nil {
+		trace.SpanFromContext(ctx).SetStatus(otelcodes.Error, err.Error())
+	}
+	t.ChanTask.Resolve(ret, err)
+}
+
+// latestBlock is the block number arg of a call at the latest block, resolved per batch by resolveLatest.
+type latestBlock struct{}
+
+// blockArg returns the block number arg of a call at blockNumber pinned per ctx, or latestBlock if not pinned yet.
+func (b *BatchableEthClient) blockArg(ctx context.Context, blockNumber *big.Int) any {
+	if blockNumber == nil {
+		if blockNumber = BlockFromCtx(ctx); blockNumber == nil {
+			return latestBlock{}
+		}
+	}
+	return toBlockNumArg(blockNumber)
+}
+
+// resolveLatest pins the calls of tasks at the latest block to the tracked head block if pinning, or else passes them
+// as "latest".
+func (b *BatchableEthClient) resolveLatest(tasks []*ethTask) {
+	var head *big.Int
+	if b.EthClient.pinLatest {
+		head = b.head.get()
+	}
+	blockArg := toBlockNumArg(head)
+	for _, task := range tasks {
+		if task.blockArg < 0 {
+			continue
+		}
+		if _, ok := task.args[task.blockArg].(latestBlock); ok {
+			task.args[task.blockArg] = blockArg
+		}
+	}
+}
+
+func NewBatchableEthClient(client *EthClient, batchCfg kutils.BatchCfg, backOff backoff.BackOff,
+	opts ...BatchableEthOption) *BatchableEthClient {
 	batchable := &BatchableEthClient{
 		EthClient: client,
 		backOff:   backOff,
 	}
-	batchable.batcher = kutils.NewChanBatcher[*CallMsg, []byte](batchCfg, batchable.batchCalls)
-	batchable.archiveBatcher = kutils.NewChanBatcher[*CallMsg, []byte](batchCfg, batchable.batchCalls)
+	for _, opt := range opts {
+		opt(batchable)
+	}
+	batchable.batcher = kutils.NewChanBatcher[*ethTask, any](batchCfg, batchable.batchCalls)
+	batchable.archiveBatcher = kutils.NewChanBatcher[*ethTask, any](batchCfg, batchable.batchCalls)
 	return batchable
 }
 
-func (b *BatchableEthClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte,
-	error) {
-	task := &CallMsg{
-		CallMsg:     msg,
-		BlockNumber: blockNumber,
-		ChanTask:    kutils.NewChanTask[[]byte](ctx),
+// batchCall queues a json-rpc call at blockNumber, routed to the full or archive node by EthClient.ClientFor, and
+// waits for its result, or returns its cached result if cacheable. The block number arg, if any, is passed as
+// latestBlock. Calls failing on the full node for missing state are retried on the archive node.
+func batchCall[T any](ctx context.Context, b *BatchableEthClient, blockNumber *big.Int, callMsg *ethereum.CallMsg,
+	method string, args ...any) (T, error) {
+	b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	ctx, span := ethTracer.Start(ctx, "eth.batch."+method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.RPCSystemKey.String("jsonrpc"), semconv.RPCMethod(method)))
+	defer span.End()
+	at := blockNumber
+	if at == nil {
+		at = BlockFromCtx(ctx)
+	}
+	task := &ethTask{
+		ChanTask: kutils.NewChanTask[any](ctx),
+		method:   method,
+		args:     args,
+		result:   new(T),
+		archive:  b.clientAt(ctx, at) != b.EthClient.Client,
+		blockArg: -1,
+		callMsg:  callMsg,
 	}
-	if blockNumber != nil {
+	for i, arg := range args {
+		if _, ok := arg.(latestBlock); ok {
+			task.blockArg, args[i] = i, b.blockArg(ctx, blockNumber)
+		}
+	}
+	if b.cache != nil {
+		if key := b.cache.key(ctx, b.EthClient, task); key != "" {
+			return cachedCall[T](ctx, b, key, task)
+		}
+	}
+	return queueCall[T](b, task)
+}
+
+// queueCall queues task in the batcher of its node and waits for its result.
+func queueCall[T any](b *BatchableEthClient, task *ethTask) (T, error) {
+	task.queuedAt = time.Now()
+	if task.archive {
 		b.archiveBatcher.Batch(task)
 	} else {
 		b.batcher.Batch(task)
 	}
-	return task.Result()
+	result, err := task.Result()
+	if err != nil {
+		return *new(T), err
+	}
+	return *result.(*T), nil
+}
+
+func (b *BatchableEthClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte,
+	error) {
+	return batchCall[hexutil.Bytes](ctx, b, blockNumber, &msg, "eth_call", toCallArg(msg), latestBlock{})
+}
+
+func (b *BatchableEthClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int,
+	error) {
+	balance, err := batchCall[hexutil.Big](ctx, b, blockNumber, nil, "eth_getBalance", account, latestBlock{})
+	return (*big.Int)(&balance), err
+}
+
+func (b *BatchableEthClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64,
+	error) {
+	nonce, err := batchCall[hexutil.Uint64](ctx, b, blockNumber, nil, "eth_getTransactionCount", account,
+		latestBlock{})
+	return uint64(nonce), err
+}
+
+func (b *BatchableEthClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte,
+	error) {
+	return batchCall[hexutil.Bytes](ctx, b, blockNumber, nil, "eth_getCode", account, latestBlock{})
+}
+
+func (b *BatchableEthClient) StorageAt(ctx context.Context, account common.Address, key common.Hash,
+	blockNumber *big.Int) ([]byte, error) {
+	return batchCall[hexutil.Bytes](ctx, b, blockNumber, nil, "eth_getStorageAt", account, key, latestBlock{})
+}
+
+func (b *BatchableEthClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	header, err := batchCall[*types.Header](ctx, b, number, nil, "eth_getBlockByNumber", latestBlock{}, false)
+	if err == nil && header == nil {
+		err = ethereum.NotFound
+	}
+	return header, err
+}
+
+func (b *BatchableEthClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	receipt, err := batchCall[*types.Receipt](ctx, b, nil, nil, "eth_getTransactionReceipt", txHash)
+	if err == nil && receipt == nil {
+		err = ethereum.NotFound
+	}
+	return receipt, err
 }
 
 // Flush executes all currently queued requests.
@@ -85,36 +318,146 @@ func (b *BatchableEthClient) Flush() {
 	b.archiveBatcher.Flush()
 }
 
+// inFlightFunc returns a function returning the number of in-flight calls, or nil if they cannot all be counted.
+func (b *BatchableEthClient) inFlightFunc() func() int64 {
+	ethInFlight := b.EthClient.inFlightFunc()
+	if ethInFlight == nil {
+		return nil
+	}
+	return func() int64 {
+		return b.inFlight.Load() + ethInFlight()
+	}
+}
+
 func (b *BatchableEthClient) Close() {
 	b.EthClient.Close()
 	b.batcher.Close()
 	b.archiveBatcher.Close()
 }
 
-func (b *BatchableEthClient) batchCalls(msgs []*CallMsg) {
-	if len(msgs) == 0 {
+func (b *BatchableEthClient) batchCalls(tasks []*ethTask) {
+	if len(tasks) == 0 {
 		return
 	}
-	ctx := kutils.CtxWithoutCancel(msgs[len(msgs)-1].Ctx())
-	reqs := make([]rpc.BatchElem, len(msgs))
-	for i, msg := range msgs {
-		reqs[i] = rpc.BatchElem{
-			Method: "eth_call",
-			Args:   []any{toCallArg(msg.CallMsg), toBlockNumArg(msg.BlockNumber)},
-			Result: new(hexutil.Bytes),
+	ctx, span := b.startBatchSpan(tasks)
+	defer span.End()
+	b.resolveLatest(tasks)
+	groups := b.groupCalls(tasks)
+	reqs, sent := make([]rpc.BatchElem, 0, len(groups)), groups[:0]
+	var fallbacks, retries []*ethTask
+	for _, group := range groups {
+		req, err := b.batchElem(group)
+		if err != nil {
+			fallbacks = append(fallbacks, group.tasks...)
+			continue
 		}
+		reqs, sent = append(reqs, req), append(sent, group)
 	}
-	if err := backoff.Retry(func() error {
-		return b.EthClient.ClientFor(msgs[0].BlockNumber).Client().BatchCallContext(ctx, reqs)
-	}, b.backOff); err != nil {
-		for _, msg := range msgs {
-			msg.Resolve(nil, err)
+	if err := b.sendBatch(ctx, tasks[0].archive, reqs); err != nil {
+		for _, task := range tasks {
+			task.Resolve(nil, err)
 		}
 		return
 	}
 	for i, req := range reqs {
-		msgs[i].Resolve(*req.Result.(*hexutil.Bytes), req.Error)
+		group := sent[i]
+		if !group.multicall {
+			if !b.resolve(group.tasks[0], req) {
+				retries = append(retries, group.tasks[0])
+			}
+		} else if !b.resolveMulticall(ctx, group, req) {
+			fallbacks = append(fallbacks, group.tasks...)
+		}
+	}
+	if len(fallbacks) != 0 {
+		retries = append(retries, b.batchCallsAlone(ctx, fallbacks)...)
+	}
+	if len(retries) != 0 {
+		for _, task := range retries {
+			task.archive = true
+			kmetric.IncOutgoingRequestRetry(task.Ctx(), kmetric.AttrRole, "archive", kmetric.AttrMethod, task.method,
+				kmetric.AttrCode, codeMissingState)
+		}
+		b.batchCallsAlone(ctx, retries)
+	}
+}
+
+// startBatchSpan starts the span of sending a batch of tasks, linked both ways with the spans of the tasks, and
+// records the batch size. The span is a new root since the batch serves many traces.
+func (b *BatchableEthClient) startBatchSpan(tasks []*ethTask) (context.Context, trace.Span) {
+	ctx, role := kutils.CtxWithoutCancel(tasks[len(tasks)-1].Ctx()), tasks[0].role()
+	kmetric.RecordEthBatchSize(ctx, int64(len(tasks)), kmetric.AttrRole, role)
+	links, now := make([]trace.Link, 0, len(tasks)), time.Now()
+	for _, task := range tasks {
+		task.sentAt = now
+		if spanContext := trace.SpanContextFromContext(task.Ctx()); spanContext.IsValid() {
+			links = append(links, trace.Link{SpanContext: spanContext})
+		}
+	}
+	ctx, span := ethTracer.Start(ctx, "eth.batch", trace.WithNewRoot(), trace.WithLinks(links...),
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(semconv.RPCSystemKey.String("jsonrpc"),
+			attribute.Int("eth.batch.size", len(tasks)), attribute.String("eth.role", role)))
+	for _, task := range tasks {
+		taskSpan := trace.SpanFromContext(task.Ctx())
+		taskSpan.AddLink(trace.Link{SpanContext: span.SpanContext()})
+		taskSpan.AddEvent("eth.batch.send", trace.WithAttributes(attribute.Int("eth.batch.size", len(tasks))))
+	}
+	return ctx, span
+}
+
+// resolve resolves task with the result of req, unless the full node misses the state to read and it should be
+// retried on the archive node.
+func (b *BatchableEthClient) resolve(task *ethTask, req rpc.BatchElem) bool {
+	if !task.archive && b.EthClient.Archive != b.EthClient.Client && isMissingState(req.Error) {
+		return false
+	}
+	task.Resolve(req.Result, req.Error)
+	return true
+}
+
+// batchCallsAlone sends tasks in a json-rpc batch without aggregating them, returning the tasks to retry on the
+// archive node.
+func (b *BatchableEthClient) batchCallsAlone(ctx context.Context, tasks []*ethTask) []*ethTask {
+	reqs := make([]rpc.BatchElem, len(tasks))
+	for i, task := range tasks {
+		reqs[i], _ = b.batchElem(&ethCallGroup{tasks: []*ethTask{task}})
+	}
+	if err := b.sendBatch(ctx, tasks[0].archive, reqs); err != nil {
+		for _, task := range tasks {
+			task.Resolve(nil, err)
+		}
+		return nil
+	}
+	var retries []*ethTask
+	for i, req := range reqs {
+		if !b.resolve(tasks[i], req) {
+			retries = append(retries, tasks[i])
+		}
 	}
+	return retries
+}
+
+// sendBatch sends reqs in a json-rpc batch to the full or archive node, retrying per backOff.
+func (b *BatchableEthClient) sendBatch(ctx context.Context, archive bool, reqs []rpc.BatchElem) error {
+	if len(reqs) == 0 {
+		return nil
+	}
+	client := b.EthClient.Client
+	if archive {
+		client = b.EthClient.Archive
+	}
+	role := "full"
+	if archive {
+		role = "archive"
+	}
+	return backoff.RetryNotify(func() error {
+		return client.Client().BatchCallContext(ctx, reqs)
+	}, b.backOff, func(err error, _ time.Duration) {
+		kmetric.IncOutgoingRequestRetry(ctx, kmetric.AttrRole, role, kmetric.AttrMethod, "batch", kmetric.AttrCode,
+			rpcErrorCode(err))
+		trace.SpanFromContext(ctx).AddEvent("eth.batch.retry", trace.WithAttributes(
+			attribute.String("error", err.Error())))
+	})
 }
 
 func toCallArg(msg ethereum.CallMsg) any {
@@ -141,17 +484,8 @@ func toBlockNumArg(number *big.Int) string {
 	if number == nil {
 		return "latest"
 	}
-	pending := big.NewInt(-1)
-	if number.Cmp(pending) == 0 {
-		return "pending"
-	}
-	finalized := big.NewInt(int64(rpc.FinalizedBlockNumber))
-	if number.Cmp(finalized) == 0 {
-		return "finalized"
-	}
-	safe := big.NewInt(int64(rpc.SafeBlockNumber))
-	if number.Cmp(safe) == 0 {
-		return "safe"
+	if number.Sign() < 0 && number.IsInt64() {
+		return rpc.BlockNumber(number.Int64()).String()
 	}
 	return hexutil.EncodeBig(number)
 }
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchableEthClientMethods(t *testing.T) {
+	klog.Log() // initializes the default logger before batchers log concurrently
+	full := newFakeEthNode(t, 100, func(n *fakeEthNode) { n.balance = 1 })
+	archive := newFakeEthNode(t, 100, func(n *fakeEthNode) { n.balance = 2 })
+	ctx := context.Background()
+	fullCli, err := Dial(ctx, full.URL)
+	require.NoError(t, err)
+	archiveCli, err := Dial(ctx, archive.URL)
+	require.NoError(t, err)
+	// each node gets a batch of 4 calls, sent as soon as all of them are queued
+	client := NewBatchableEthClient(&EthClient{Client: fullCli, Archive: archiveCli}, func() (time.Duration, int) {
+		return time.Hour, 4
+	}, &backoff.StopBackOff{})
+	defer client.Close()
+
+	account, block := common.HexToAddress("0x1"), big.NewInt(100)
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+	run(func() {
+		balance, err := client.BalanceAt(ctx, account, nil)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, balance.Int64())
+	})
+	run(func() {
+		balance, err := client.BalanceAt(ctx, account, block)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 2, balance.Int64())
+	})
+	run(func() {
+		nonce, err := client.NonceAt(ctx, account, nil)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 7, nonce)
+	})
+	run(func() {
+		nonce, err := client.NonceAt(ctx, account, block)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 7, nonce)
+	})
+	run(func() {
+		code, err := client.CodeAt(ctx, account, block)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0xc0, 0xde}, code)
+	})
+	run(func() {
+		storage, err := client.StorageAt(ctx, account, common.Hash{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0xc0, 0xde}, storage)
+	})
+	run(func() {
+		header, err := client.HeaderByNumber(ctx, block)
+		if assert.NoError(t, err) {
+			assert.EqualValues(t, 100, header.Number.Int64())
+		}
+	})
+	run(func() {
+		_, err := client.TransactionReceipt(ctx, common.Hash{})
+		assert.ErrorIs(t, err, ethereum.NotFound)
+	})
+	wg.Wait()
+
+	assert.EqualValues(t, 1, full.requests.Load())
+	assert.EqualValues(t, 1, archive.requests.Load())
+	assert.ElementsMatch(t, []string{"eth_getBalance", "eth_getTransactionCount", "eth_getStorageAt",
+		"eth_getTransactionReceipt"}, full.methods())
+	assert.ElementsMatch(t, []string{"eth_getBalance", "eth_getTransactionCount", "eth_getCode",
+		"eth_getBlockByNumber"}, archive.methods())
+}
@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/KyberNetwork/kutils"
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultEthCacheSize          = 10000
+	defaultEthCacheConfirmations = 64
+	defaultEthCacheRedisPrefix   = "eth_cache:"
+	defaultEthCacheRedisTtl      = 24 * time.Hour
+	ethCacheHeadTtl              = time.Second
+)
+
+// EthCacheCfg caches the results of BatchableEthClient calls at blocks deep enough to be final, keyed by chain, block
+// number and call args. Results are cached in an in-memory lru, and in redis if configured to share them across
+// replicas. Concurrent identical calls are sent only once.
+type EthCacheCfg struct {
+	Size          int    // max results in the in-memory lru, default 10000
+	Confirmations uint64 // blocks behind the head block for results at a block to be cached, default 64
+
+	Redis       *RedisCfg
+	RedisPrefix string        // prefix of redis keys, default eth_cache:
+	RedisTtl    time.Duration // ttl of results in redis, default 24h
+
+	cache *ethCache
+}
+
+// onUpdate updates the redis client of c and creates its cache, keeping the lru of old if of the same size. It must
+// only be called once the client using the cache is reloaded, as it replaces the redis client of old.
+func (c *EthCacheCfg) onUpdate(old *EthCacheCfg) {
+	var oldRedis *RedisCfg
+	if old != nil {
+		oldRedis = old.Redis
+	}
+	if c == nil || c.Redis == nil {
+		oldRedis.close() // redis is no longer used
+		if c == nil {
+			return
+		}
+	} else {
+		c.Redis.OnUpdate(oldRedis, c.Redis)
+	}
+	c.cache = newEthCache(c)
+	if old != nil && old.cache != nil && old.Size == c.Size {
+		c.cache.lru = old.cache.lru
+	}
+}
+
+// keep takes over the cache and redis client of old, kept by the previous client if the reload of its config failed.
+func (c *EthCacheCfg) keep(old *EthCacheCfg) {
+	if c != nil && old != nil {
+		c.cache = old.cache
+		c.Redis.keep(old.Redis)
+	}
+}
+
+// get returns the cache of c, creating it if c was not updated as hotcfg.
+func (c *EthCacheCfg) get() *ethCache {
+	if c.cache == nil {
+		c.cache = newEthCache(c)
+	}
+	return c.cache
+}
+
+// ethCache caches json encoded results of eth calls.
+type ethCache struct {
+	lru           *lru.Cache[string, []byte]
+	redis         redis.UniversalClient
+	redisPrefix   string
+	redisTtl      time.Duration
+	confirmations uint64
+	group         singleflight.Group
+
+	chainId atomic.Pointer[big.Int]
+	head    atomic.Pointer[cachedHead]
+}
+
+// cachedHead is a head block number fetched at some time.
+type cachedHead struct {
+	number    uint64
+	fetchedAt time.Time
+}
+
+func newEthCache(cfg *EthCacheCfg) *ethCache {
+	c := &ethCache{
+		lru:           lru.NewCache[string, []byte](cfg.Size),
+		redisPrefix:   cfg.RedisPrefix,
+		redisTtl:      cfg.RedisTtl,
+		confirmations: cfg.Confirmations,
+	}
+	if cfg.Size <= 0 {
+		c.lru = lru.NewCache[string, []byte](defaultEthCacheSize)
+	}
+	if cfg.Redis != nil {
+		c.redis = cfg.Redis.C
+	}
+	if c.redisPrefix == "" {
+		c.redisPrefix = defaultEthCacheRedisPrefix
+	}
+	if c.redisTtl <= 0 {
+		c.redisTtl = defaultEthCacheRedisTtl
+	}
+	if c.confirmations == 0 {
+		c.confirmations = defaultEthCacheConfirmations
+	}
+	return c
+}
+
+// key returns the cache key of a call of task, or "" if its result is not cacheable, i.e. if it is not at a block
+// number with enough confirmations.
+func (c *ethCache) key(ctx context.Context, client *EthClient, task *ethTask) string {
+	if task.blockArg < 0 {
+		return ""
+	}
+	blockArg, ok := task.args[task.blockArg].(string)
+	if !ok {
+		return ""
+	}
+	blockNumber, err := hexutil.DecodeUint64(blockArg)
+	if err != nil {
+		return ""
+	}
+	if head, err := c.headBlock(ctx, client); err != nil || blockNumber+c.confirmations > head {
+		return ""
+	}
+	chainId, err := c.chainID(ctx, client)
+	if err != nil {
+		return ""
+	}
+	args, err := json.Marshal(task.args)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d:%s:%x", chainId, blockNumber, task.method, crypto.Keccak256(args))
+}
+
+// headBlock returns the head block number of client, as tracked if pinning latest calls, or else fetched at most once
+// per ethCacheHeadTtl.
+func (c *ethCache) headBlock(ctx context.Context, client *EthClient) (uint64, error) {
+	if head := client.head.get(); head != nil {
+		return head.Uint64(), nil
+	}
+	if head := c.head.Load(); head != nil && time.Since(head.fetchedAt) < ethCacheHeadTtl {
+		return head.number, nil
+	}
+	head, err, _ := c.group.Do("\x00head", func() (any, error) {
+		head, err := client.Client.BlockNumber(kutils.CtxWithoutCancel(ctx))
+		if err != nil {
+			return uint64(0), errors.Wrap(err, "ethCache.headBlock")
+		}
+		c.head.Store(&cachedHead{number: head, fetchedAt: time.Now()})
+		return head, nil
+	})
+	return head.(uint64), err
+}
+
+// chainID returns the chain id of client, fetched once.
+func (c *ethCache) chainID(ctx context.Context, client *EthClient) (*big.Int, error) {
+	if chainId := c.chainId.Load(); chainId != nil {
+		return chainId, nil
+	}
+	chainId, err, _ := c.group.Do("\x00chainId", func() (any, error) {
+		chainId, err := client.Client.ChainID(kutils.CtxWithoutCancel(ctx))
+		if err != nil {
+			return (*big.Int)(nil), errors.Wrap(err, "ethCache.chainID")
+		}
+		c.chainId.Store(chainId)
+		return chainId, nil
+	})
+	return chainId.(*big.Int), err
+}
+
+// load returns the cached result of key from the lru, or else from redis.
+func (c *ethCache) load(ctx context.Context, key string) ([]byte, bool) {
+	if value, ok := c.lru.Get(key); ok {
+		return value, true
+	}
+	if c.redis == nil {
+		return nil, false
+	}
+	value, err := c.redis.Get(ctx, c.redisPrefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			klog.Debugf(ctx, "ethCache.load|redis get failed|key=%s|err=%v", key, err)
+		}
+		return nil, false
+	}
+	c.lru.Add(key, value)
+	return value, true
+}
+
+// store caches the result of key in the lru and redis.
+func (c *ethCache) store(ctx context.Context, key string, value []byte) {
+	c.lru.Add(key, value)
+	if c.redis == nil {
+		return
+	}
+	if err := c.redis.Set(ctx, c.redisPrefix+key, value, c.redisTtl).Err(); err != nil {
+		klog.Debugf(ctx, "ethCache.store|redis set failed|key=%s|err=%v", key, err)
+	}
+}
+
+// cachedCall returns the cached result of task if cached, or else queues it once for all concurrent identical calls and
+// caches its result if found.
+func cachedCall[T any](ctx context.Context, b *BatchableEthClient, key string, task *ethTask) (T, error) {
+	var result T
+	value, ok := b.cache.load(ctx, key)
+	if !ok {
+		ch := b.cache.group.DoChan(key, func() (any, error) {
+			ctx := kutils.CtxWithoutCancel(ctx)
+			task.ChanTask = kutils.NewChanTask[any](ctx)
+			result, err := queueCall[T](b, task)
+			if err != nil {
+				return nil, err
+			}
+			value, err := json.Marshal(result)
+			if err != nil {
+				return nil, errors.Wrap(err, "cachedCall|marshal result")
+			}
+			if string(value) != "null" {
+				b.cache.store(ctx, key, value)
+			}
+			return value, nil
+		})
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case res := <-ch:
+			if res.Err != nil {
+				return result, res.Err
+			}
+			value = res.Val.([]byte)
+		}
+	}
+	err := json.Unmarshal(value, &result)
+	return result, errors.Wrap(err, "cachedCall|unmarshal result")
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchableEthClientCache(t *testing.T) {
+	klog.Log()
+	server := newFakeEthNode(t, 1000)
+	redisServer := miniredis.RunT(t)
+	newCfg := func() *BatchableEthCfg {
+		cfg := &BatchableEthCfg{EthCfg: EthCfg{Url: server.URL}, BatchRate: time.Millisecond, BatchCnt: 100,
+			BackOff: &BackoffCfg{MaxRetries: 1}, Cache: &EthCacheCfg{Confirmations: 10, Redis: &RedisCfg{
+				UniversalOptions: redis.UniversalOptions{Addrs: []string{redisServer.Addr()}}}}}
+		cfg.OnUpdate(nil, cfg)
+		t.Cleanup(cfg.C.Close)
+		return cfg
+	}
+	ctx := context.Background()
+	balanceAt := func(cfg *BatchableEthCfg, blockNumber int64) {
+		var wg sync.WaitGroup
+		for range 5 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := cfg.C.BalanceAt(ctx, common.Address{}, big.NewInt(blockNumber))
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+	}
+
+	replica1 := newCfg()
+	balanceAt(replica1, 100)
+	balanceAt(replica1, 100)
+	assert.Equal(t, 1, server.countAt("eth_getBalance", 100), "concurrent and later identical calls are sent once")
+
+	replica2 := newCfg()
+	balanceAt(replica2, 100)
+	assert.Equal(t, 1, server.countAt("eth_getBalance", 100), "results are shared via redis")
+
+	balanceAt(replica1, 995)
+	balanceAt(replica1, 995)
+	assert.Greater(t, server.countAt("eth_getBalance", 995), 1, "results of unconfirmed blocks are not cached")
+
+	snapshotCtx := CtxWithBlock(ctx, big.NewInt(100))
+	_, err := replica2.C.NonceAt(snapshotCtx, common.Address{}, nil)
+	require.NoError(t, err)
+	_, err = replica2.C.NonceAt(snapshotCtx, common.Address{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, replica2.Cache.cache.lru.Len(), "pinned latest calls are cached")
+
+	invalidCfg := &BatchableEthCfg{EthCfg: EthCfg{Url: "/relative"}, BackOff: &BackoffCfg{MaxRetries: 1},
+		Cache: &EthCacheCfg{Confirmations: 10, Redis: &RedisCfg{
+			UniversalOptions: redis.UniversalOptions{Addrs: []string{redisServer.Addr()}}}}}
+	invalidCfg.OnUpdate(replica2, invalidCfg)
+	reloadErrs.Delete(invalidCfg.name("BatchableEthCfg"))
+	assert.Same(t, replica2.C, invalidCfg.C)
+	assert.Same(t, replica2.Cache.cache, invalidCfg.Cache.cache, "cache is kept if the reload fails")
+	assert.Same(t, replica2.Cache.Redis.C, invalidCfg.Cache.Redis.C, "redis client is kept if the reload fails")
+	assert.NoError(t, replica2.Cache.Redis.C.Ping(ctx).Err(), "kept redis client is not closed")
+
+	replica2.Cache.Redis.Reload.DrainTimeout = time.Millisecond
+	noRedisCfg := &BatchableEthCfg{EthCfg: EthCfg{Url: server.URL}, BatchRate: time.Millisecond, BatchCnt: 100,
+		BackOff: &BackoffCfg{MaxRetries: 1}, Cache: &EthCacheCfg{Confirmations: 10}}
+	noRedisCfg.OnUpdate(replica2, noRedisCfg)
+	t.Cleanup(noRedisCfg.C.Close)
+	assert.Eventually(t, func() bool {
+		return replica2.Cache.Redis.C.Ping(ctx).Err() != nil
+	}, time.Second, 10*time.Millisecond, "redis client is closed once removed")
+
+	firstCfg := &BatchableEthCfg{EthCfg: EthCfg{Url: "/relative"}, BackOff: &BackoffCfg{MaxRetries: 1}}
+	firstCfg.OnUpdate(nil, firstCfg)
+	reloadErrs.Delete(firstCfg.name("BatchableEthCfg"))
+	assert.Nil(t, firstCfg.C, "no client without an eth client to wrap")
+}
@@ -0,0 +1,395 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+)
+
+const (
+	defaultEthCheckInterval = 10 * time.Second
+	defaultEthMaxBlockLag   = 5
+	defaultEthMinScore      = 0.5
+	defaultEthMaxAttempts   = 3
+
+	ethHealthDecay = 0.1 // weight of the latest outcome in the moving averages of endpoint health
+
+	// failoverUrl is the placeholder url of rpc clients over failover transports, replaced by endpoint urls.
+	failoverUrl = "http://failover"
+)
+
+// EthEndpoint is an eth rpc endpoint.
+type EthEndpoint struct {
+	Url      string
+	Name     string // name in metrics and logs, default the url host, which excludes api keys in url paths
+	Weight   int    // relative share of requests among healthy endpoints of the same priority, default 1
+	Priority int    // endpoints of the lowest priority with healthy ones are used, default 0
+}
+
+func (e *EthEndpoint) name() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return urlHost(e.Url)
+}
+
+// EthHealthCfg configures the health scoring of eth rpc endpoints. The score of an endpoint in [0, 1] is the product
+// of its success rate, its latency relative to the fastest endpoint and its head block lag behind the highest head
+// block, averaged over recent requests and head block checks.
+type EthHealthCfg struct {
+	CheckInterval time.Duration // interval of checking the head block of each endpoint, default 10s
+	MaxBlockLag   uint64        // head block lag at which an endpoint is unhealthy, default 5
+	MinScore      float64       // min score for an endpoint to be healthy, default 0.5
+	MaxAttempts   int           // max endpoints to try per request on transport or rate-limit errors, default 3
+}
+
+func (c *EthHealthCfg) withDefaults() EthHealthCfg {
+	cfg := *c
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaultEthCheckInterval
+	}
+	if cfg.MaxBlockLag == 0 {
+		cfg.MaxBlockLag = defaultEthMaxBlockLag
+	}
+	if cfg.MinScore <= 0 {
+		cfg.MinScore = defaultEthMinScore
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultEthMaxAttempts
+	}
+	return cfg
+}
+
+// ethEndpoint is an eth rpc endpoint with its health stats.
+type ethEndpoint struct {
+	EthEndpoint
+	label     string
+	url       *url.URL
+	transport http.RoundTripper
+
+	mu      sync.Mutex
+	errRate float64 // moving average of failures
+	latency float64 // moving average of successful request latencies in seconds, 0 if unknown
+	head    uint64  // last checked head block, 0 if unknown
+}
+
+// record records the outcome of a request to the endpoint.
+func (e *ethEndpoint) record(failed bool, latency time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if failed {
+		e.errRate += ethHealthDecay * (1 - e.errRate)
+		return
+	}
+	e.errRate -= ethHealthDecay * e.errRate
+	if e.latency == 0 {
+		e.latency = latency.Seconds()
+	} else {
+		e.latency += ethHealthDecay * (latency.Seconds() - e.latency)
+	}
+}
+
+// ethEndpointPool balances requests over the endpoints of a role (full or archive node) by health, failing over to
+// other endpoints on transport and rate-limit errors.
+type ethEndpointPool struct {
+	role      string
+	cfg       EthHealthCfg
+	endpoints []*ethEndpoint
+	cancel    context.CancelFunc
+}
+
+// newEthEndpointPool creates a pool of http(s) endpoints, and starts checking their head blocks.
+func newEthEndpointPool(role string, endpoints []EthEndpoint, cfg EthHealthCfg,
+	newTransport func(endpoint string) http.RoundTripper) (*ethEndpointPool, error) {
+	pool := &ethEndpointPool{role: role, cfg: cfg.withDefaults()}
+	for _, endpoint := range endpoints {
+		if !isHttpUrl(endpoint.Url) {
+			return nil, errors.Errorf("ethEndpointPool|failover requires http(s) endpoints|url=%s", endpoint.name())
+		}
+		u, err := url.Parse(endpoint.Url)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ethEndpointPool|parse url of %s", endpoint.name())
+		}
+		if endpoint.Weight <= 0 {
+			endpoint.Weight = 1
+		}
+		pool.endpoints = append(pool.endpoints, &ethEndpoint{
+			EthEndpoint: endpoint,
+			label:       endpoint.name(),
+			url:         u,
+			transport:   newTransport(endpoint.name()),
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.cancel = cancel
+	go pool.checkHeads(ctx)
+	return pool, nil
+}
+
+// Close stops checking head blocks.
+func (p *ethEndpointPool) Close() {
+	p.cancel()
+}
+
+// scores returns the health score of each endpoint.
+func (p *ethEndpointPool) scores() ([]float64, []uint64) {
+	var maxHead uint64
+	minLatency := math.Inf(1)
+	for _, endpoint := range p.endpoints {
+		endpoint.mu.Lock()
+		maxHead = max(maxHead, endpoint.head)
+		if endpoint.latency > 0 {
+			minLatency = min(minLatency, endpoint.latency)
+		}
+		endpoint.mu.Unlock()
+	}
+	scores, lags := make([]float64, len(p.endpoints)), make([]uint64, len(p.endpoints))
+	for i, endpoint := range p.endpoints {
+		endpoint.mu.Lock()
+		score := 1 - endpoint.errRate
+		if endpoint.latency > 0 && !math.IsInf(minLatency, 1) {
+			score *= minLatency / endpoint.latency
+		}
+		if endpoint.head != 0 {
+			lags[i] = maxHead - endpoint.head
+			score *= max(0, 1-float64(lags[i])/float64(p.cfg.MaxBlockLag))
+		}
+		endpoint.mu.Unlock()
+		scores[i] = score
+	}
+	return scores, lags
+}
+
+// pick returns the index of the endpoint to send a request to, excluding tried ones: an endpoint of the lowest
+// priority among healthy ones, picked randomly by weight and score, or the endpoint with the highest score if none
+// is healthy. It returns -1 if all endpoints were tried.
+func (p *ethEndpointPool) pick(tried []bool) int {
+	scores, _ := p.scores()
+	best, bestPriority := -1, math.MaxInt
+	for i, endpoint := range p.endpoints {
+		if !tried[i] && scores[i] >= p.cfg.MinScore {
+			bestPriority = min(bestPriority, endpoint.Priority)
+		}
+	}
+	if bestPriority == math.MaxInt {
+		for i := range p.endpoints {
+			if !tried[i] && (best < 0 || scores[i] > scores[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	var total float64
+	for i, endpoint := range p.endpoints {
+		if !tried[i] && scores[i] >= p.cfg.MinScore && endpoint.Priority == bestPriority {
+			total += float64(endpoint.Weight) * scores[i]
+		}
+	}
+	target := rand.Float64() * total
+	for i, endpoint := range p.endpoints {
+		if !tried[i] && scores[i] >= p.cfg.MinScore && endpoint.Priority == bestPriority {
+			best = i
+			if target -= float64(endpoint.Weight) * scores[i]; target < 0 {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// RoundTrip sends req to the healthiest endpoint, trying up to MaxAttempts endpoints on transport errors, 429, 5xx,
+// json-rpc rate-limit errors, and blocks not found by endpoints lagging behind the block a call is pinned to.
+func (p *ethEndpointPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	tried := make([]bool, len(p.endpoints))
+	var resp *http.Response
+	var err error
+	for attempt := 1; attempt <= p.cfg.MaxAttempts; attempt++ {
+		i := p.pick(tried)
+		if i < 0 {
+			break
+		}
+		tried[i] = true
+		if resp != nil {
+			_ = resp.Body.Close() // discards the failed response of the previous attempt
+		}
+		endpoint := p.endpoints[i]
+		if attempt > 1 {
+			kmetric.IncOutgoingRequestRetry(ctx, kmetric.AttrTarget, endpoint.url.Host, kmetric.AttrEndpoint,
+				endpoint.label, kmetric.AttrMethod, req.Method, kmetric.AttrAttempt, strconv.Itoa(attempt))
+		}
+		endpointReq, cloneErr := cloneRequest(req)
+		if cloneErr != nil {
+			return nil, cloneErr
+		}
+		endpointReq.URL, endpointReq.Host = endpoint.url, ""
+		startTime := time.Now()
+		resp, err = endpoint.transport.RoundTrip(endpointReq)
+		failover, lagging := err != nil, false
+		if err == nil {
+			failover, lagging = ethFailover(resp)
+		}
+		failover = failover && ctx.Err() == nil
+		// lagging endpoints are accounted for by their head block lag rather than as failures
+		endpoint.record(failover && !lagging, time.Since(startTime))
+		if !failover {
+			return resp, err
+		}
+		klog.Debugf(ctx, "ethEndpointPool.RoundTrip|failing over|role=%s|endpoint=%s|lagging=%t|err=%v", p.role,
+			endpoint.label, lagging, err)
+	}
+	return resp, err
+}
+
+// ethFailover checks whether resp is a 429, 5xx or json-rpc rate-limit error to fail over from, or a block not found
+// error of an endpoint lagging behind the requested block, which may be found by other endpoints. The body of other
+// responses is inspected via readJsonRpcResponse.
+func ethFailover(resp *http.Response) (failover, lagging bool) {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return true, false
+	}
+	msgs, err := readJsonRpcResponse(resp)
+	if err != nil {
+		return false, false
+	}
+	if isEthRateLimited(msgs) {
+		return true, false
+	}
+	lagging = isEthBlockNotFound(msgs)
+	return lagging, lagging
+}
+
+// jsonRpcBody is a buffered json-rpc response body along with its parsed messages.
+type jsonRpcBody struct {
+	*bytes.Reader
+	msgs []jsonRpcMessage
+}
+
+func (*jsonRpcBody) Close() error {
+	return nil
+}
+
+// readJsonRpcResponse buffers the body of resp to parse its json-rpc messages, replacing it with a jsonRpcBody so that
+// the transports wrapping the one reading it first, such as ethEndpointPool over jsonRpcMetricsTransport, reuse the
+// parsed messages instead of buffering and parsing the body again.
+func readJsonRpcResponse(resp *http.Response) ([]jsonRpcMessage, error) {
+	if body, ok := resp.Body.(*jsonRpcBody); ok {
+		return body.msgs, nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return nil, err
+	}
+	msgs := parseJsonRpc(data)
+	resp.Body = &jsonRpcBody{Reader: bytes.NewReader(data), msgs: msgs}
+	return msgs, nil
+}
+
+// isEthRateLimited checks whether a json-rpc response or any of a batch response is a rate-limit error.
+func isEthRateLimited(responses []jsonRpcMessage) bool {
+	for _, response := range responses {
+		if response.Error == nil {
+			continue
+		}
+		message := strings.ToLower(response.Error.Message)
+		if response.Error.Code == -32005 || response.Error.Code == http.StatusTooManyRequests ||
+			strings.Contains(message, "rate limit") || strings.Contains(message, "too many requests") {
+			return true
+		}
+	}
+	return false
+}
+
+// isEthBlockNotFound checks whether a json-rpc response or any of a batch response fails for a block unknown to the
+// node, such as a block pinned by the head of another endpoint.
+func isEthBlockNotFound(responses []jsonRpcMessage) bool {
+	for _, response := range responses {
+		if response.Error == nil {
+			continue
+		}
+		message := strings.ToLower(response.Error.Message)
+		if strings.Contains(message, "header not found") || strings.Contains(message, "unknown block") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHeads checks the head block of each endpoint every CheckInterval until ctx is done.
+func (p *ethEndpointPool) checkHeads(ctx context.Context) {
+	rpcClients := make([]*rpc.Client, len(p.endpoints))
+	for i, endpoint := range p.endpoints {
+		var err error
+		if rpcClients[i], err = rpc.DialOptions(ctx, endpoint.Url,
+			rpc.WithHTTPClient(&http.Client{Transport: endpoint.transport})); err != nil {
+			klog.Errorf(ctx, "ethEndpointPool.checkHeads|failed to dial|endpoint=%s|err=%v", endpoint.label, err)
+			return
+		}
+	}
+	defer func() {
+		for _, rpcClient := range rpcClients {
+			rpcClient.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(p.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for i, endpoint := range p.endpoints {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.checkHead(ctx, endpoint, rpcClients[i])
+			}()
+		}
+		wg.Wait()
+		scores, lags := p.scores()
+		for i, endpoint := range p.endpoints {
+			kmetric.RecordEndpointHealth(ctx, scores[i], int64(lags[i]), kmetric.AttrTarget, endpoint.url.Host,
+				kmetric.AttrEndpoint, endpoint.label)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHead checks the head block of an endpoint, recording the outcome in its health stats.
+func (p *ethEndpointPool) checkHead(ctx context.Context, endpoint *ethEndpoint, rpcClient *rpc.Client) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.CheckInterval)
+	defer cancel()
+	startTime := time.Now()
+	var head hexutil.Uint64
+	err := rpcClient.CallContext(ctx, &head, "eth_blockNumber")
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		return
+	}
+	endpoint.record(err != nil, time.Since(startTime))
+	if err != nil {
+		klog.Debugf(ctx, "ethEndpointPool.checkHead|failed|role=%s|endpoint=%s|err=%v", p.role, endpoint.label, err)
+		return
+	}
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+	endpoint.head = uint64(head)
+}
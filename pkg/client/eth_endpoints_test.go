@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEthCfgFailover(t *testing.T) {
+	server1 := newFakeEthNode(t, 100, func(n *fakeEthNode) { n.rateLimited.Store(true) })
+	server2 := newFakeEthNode(t, 100)
+	server3 := newFakeEthNode(t, 100)
+
+	cfg := &EthCfg{
+		Endpoints: []EthEndpoint{
+			{Url: server1.URL, Name: "primary"},
+			{Url: server2.URL, Name: "secondary"},
+			{Url: server3.URL, Name: "backup", Priority: 1},
+		},
+		Health: EthHealthCfg{CheckInterval: time.Hour},
+	}
+	cfg.OnUpdate(nil, cfg)
+	require.NotNil(t, cfg.C)
+	defer cfg.C.Close()
+
+	ctx := context.Background()
+	for range 20 {
+		chainId, err := cfg.C.ChainID(ctx)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, chainId.Int64())
+	}
+	assert.Len(t, server2.callsOf("eth_chainId"), 20, "all calls succeed on the secondary endpoint")
+	assert.Less(t, len(server1.callsOf("eth_chainId")), 20, "rate-limited endpoint becomes unhealthy")
+	assert.Empty(t, server3.callsOf("eth_chainId"), "backup endpoint is not used while others are healthy")
+
+	server2.rateLimited.Store(true)
+	_, err := cfg.C.ChainID(ctx)
+	require.NoError(t, err)
+	assert.Len(t, server3.callsOf("eth_chainId"), 1, "fails over to backup endpoint")
+}
+
+func TestEthCfgPinnedFailover(t *testing.T) {
+	klog.Log()
+	server1, server2 := newFakeEthNode(t, 100), newFakeEthNode(t, 100)
+	cfg := &EthCfg{
+		Endpoints:    []EthEndpoint{{Url: server1.URL, Priority: 1}, {Url: server2.URL}},
+		Health:       EthHealthCfg{CheckInterval: 10 * time.Millisecond, MaxBlockLag: 100, MinScore: 0.01},
+		PinLatest:    true,
+		HeadInterval: 10 * time.Millisecond,
+	}
+	cfg.OnUpdate(nil, cfg)
+	require.NotNil(t, cfg.C)
+	defer cfg.C.Close()
+	require.Eventually(t, func() bool {
+		head := cfg.C.head.get()
+		return head != nil && head.Uint64() == 100
+	}, time.Second, 10*time.Millisecond)
+	server2.head.Store(98)
+
+	ctx := context.Background()
+	for range 20 {
+		_, err := cfg.C.BalanceAt(ctx, common.Address{}, nil)
+		require.NoError(t, err, "lagging endpoint fails over for the pinned block")
+	}
+	assert.Equal(t, 20, server1.countAt("eth_getBalance", 100))
+	assert.Equal(t, 20, server2.countAt("eth_getBalance", 100), "lagging endpoint is tried first")
+}
+
+func TestEthEndpointPoolScores(t *testing.T) {
+	server1, server2 := newFakeEthNode(t, 100), newFakeEthNode(t, 97)
+	pool, err := newEthEndpointPool("full", []EthEndpoint{{Url: server1.URL}, {Url: server2.URL}},
+		EthHealthCfg{CheckInterval: time.Hour, MaxBlockLag: 4}, func(endpoint string) http.RoundTripper {
+			return newEthTransport("full", endpoint)
+		})
+	require.NoError(t, err)
+	defer pool.Close()
+
+	require.Eventually(t, func() bool {
+		_, lags := pool.scores()
+		return lags[1] == 3
+	}, time.Second, 10*time.Millisecond)
+	scores, _ := pool.scores()
+	assert.Greater(t, scores[0], scores[1])
+	assert.Less(t, scores[1], 0.5, "lagging endpoint is unhealthy")
+	for range 10 {
+		assert.Equal(t, 0, pool.pick([]bool{false, false}))
+	}
+}
+
+func TestEthFailover(t *testing.T) {
+	rateLimited := func(body string) bool {
+		return isEthRateLimited(parseJsonRpc([]byte(body)))
+	}
+	assert.True(t, rateLimited(`{"jsonrpc":"2.0","id":1,"error":{"code":-32005,"message":"limit"}}`))
+	assert.True(t, rateLimited(`[{"id":1,"result":"0x1"},{"id":2,"error":{"code":-32000,`+
+		`"message":"Too Many Requests"}}]`))
+	assert.False(t, rateLimited(`{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"reverted"}}`))
+	assert.False(t, rateLimited(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+
+	blockNotFound := func(body string) bool {
+		return isEthBlockNotFound(parseJsonRpc([]byte(body)))
+	}
+	assert.True(t, blockNotFound(`[{"id":1,"result":"0x1"},{"id":2,"error":{"code":-32000,`+
+		`"message":"header not found"}}]`))
+	assert.False(t, blockNotFound(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"missing trie node"}}`))
+
+	body := `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"header not found"}}`
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}
+	msgs, err := readJsonRpcResponse(resp)
+	require.NoError(t, err)
+	failover, lagging := ethFailover(resp)
+	assert.True(t, failover && lagging)
+	parsedBody, ok := resp.Body.(*jsonRpcBody)
+	require.True(t, ok)
+	assert.Same(t, &msgs[0], &parsedBody.msgs[0], "response is parsed once")
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(data))
+}
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+)
+
+// Multicall3Address is the address of the canonical Multicall3 deployment, the same on most evm chains.
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+const multicall3Abi = `[{"inputs":[{"components":[{"name":"target","type":"address"},{"name":"allowFailure",
+"type":"bool"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"aggregate3",
+"outputs":[{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],
+"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+var multicall3 = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(multicall3Abi))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// multicall3Call is a call of Multicall3.aggregate3.
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// multicall3Result is a result of Multicall3.aggregate3.
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// RevertError is the error of a reverted call aggregated by Multicall3, the same as that of an eth_call reverting on
+// an rpc node: it implements rpc.Error and rpc.DataError with the revert data.
+type RevertError struct {
+	Data []byte // revert data
+}
+
+func (e *RevertError) Error() string {
+	if reason, err := abi.UnpackRevert(e.Data); err == nil {
+		return "execution reverted: " + reason
+	}
+	return "execution reverted"
+}
+
+// ErrorCode returns the json-rpc error code of reverted eth_call's.
+func (e *RevertError) ErrorCode() int {
+	return 3
+}
+
+// ErrorData returns the hex-encoded revert data.
+func (e *RevertError) ErrorData() any {
+	return hexutil.Encode(e.Data)
+}
+
+var (
+	_ rpc.Error     = (*RevertError)(nil)
+	_ rpc.DataError = (*RevertError)(nil)
+)
+
+// isMulticallable checks whether task is an eth_call that can be aggregated by Multicall3, i.e. whether it only has a
+// target and data. Aggregated calls are sent from the Multicall3 contract instead of the zero address.
+func isMulticallable(task *ethTask) bool {
+	msg := task.callMsg
+	return msg != nil && msg.To != nil && msg.From == (common.Address{}) && (msg.Value == nil || msg.Value.Sign() == 0) &&
+		msg.Gas == 0 && msg.GasPrice == nil && msg.GasFeeCap == nil && msg.GasTipCap == nil &&
+		len(msg.AccessList) == 0 && msg.BlobGasFeeCap == nil && len(msg.BlobHashes) == 0 &&
+		len(msg.AuthorizationList) == 0
+}
+
+// packMulticall encodes eth_call tasks into the data of a Multicall3.aggregate3 call allowing each of them to fail.
+func packMulticall(tasks []*ethTask) ([]byte, error) {
+	calls := make([]multicall3Call, len(tasks))
+	for i, task := range tasks {
+		calls[i] = multicall3Call{Target: *task.callMsg.To, AllowFailure: true, CallData: task.callMsg.Data}
+	}
+	data, err := multicall3.Pack("aggregate3", calls)
+	return data, errors.Wrap(err, "packMulticall")
+}
+
+// unpackMulticall decodes the return data of a Multicall3.aggregate3 call of n calls. Empty return data means that
+// Multicall3 is not deployed at the called address and block.
+func unpackMulticall(data []byte, n int) ([]multicall3Result, error) {
+	if len(data) == 0 {
+		return nil, errors.New("unpackMulticall|empty return data, multicall3 not deployed")
+	}
+	out, err := multicall3.Unpack("aggregate3", data)
+	if err != nil {
+		return nil, errors.Wrap(err, "unpackMulticall")
+	}
+	results := *abi.ConvertType(out[0], new([]multicall3Result)).(*[]multicall3Result)
+	if len(results) != n {
+		return nil, errors.Errorf("unpackMulticall|got %d results for %d calls", len(results), n)
+	}
+	return results, nil
+}
+
+// ethCallGroup is a json-rpc call of a batch, either of a single task or of a Multicall3.aggregate3 of several
+// eth_call tasks.
+type ethCallGroup struct {
+	tasks     []*ethTask
+	multicall bool
+}
+
+// groupCalls groups eth_call tasks aggregatable by Multicall3 per block, leaving the other tasks on their own.
+func (b *BatchableEthClient) groupCalls(tasks []*ethTask) []*ethCallGroup {
+	groups := make([]*ethCallGroup, 0, len(tasks))
+	if b.multicallAddress == nil || b.multicallMissing.Load() {
+		for _, task := range tasks {
+			groups = append(groups, &ethCallGroup{tasks: []*ethTask{task}})
+		}
+		return groups
+	}
+	multicallGroups := make(map[string]*ethCallGroup)
+	for _, task := range tasks {
+		if !isMulticallable(task) {
+			groups = append(groups, &ethCallGroup{tasks: []*ethTask{task}})
+			continue
+		}
+		blockArg := task.args[task.blockArg].(string)
+		group, ok := multicallGroups[blockArg]
+		if !ok {
+			group = &ethCallGroup{multicall: true}
+			multicallGroups[blockArg] = group
+			groups = append(groups, group)
+		}
+		group.tasks = append(group.tasks, task)
+	}
+	for _, group := range groups {
+		group.multicall = group.multicall && len(group.tasks) > 1
+	}
+	return groups
+}
+
+// batchElem returns the json-rpc call of group.
+func (b *BatchableEthClient) batchElem(group *ethCallGroup) (rpc.BatchElem, error) {
+	task := group.tasks[0]
+	if !group.multicall {
+		return rpc.BatchElem{Method: task.method, Args: task.args, Result: task.result}, nil
+	}
+	data, err := packMulticall(group.tasks)
+	if err != nil {
+		return rpc.BatchElem{}, err
+	}
+	callMsg := ethereum.CallMsg{To: b.multicallAddress, Data: data}
+	return rpc.BatchElem{
+		Method: "eth_call",
+		Args:   []any{toCallArg(callMsg), task.args[task.blockArg]},
+		Result: new(hexutil.Bytes),
+	}, nil
+}
+
+// resolveMulticall resolves the tasks of a multicall group from the result of its eth_call, returning false if it
+// failed as a whole and its tasks should be sent on their own instead.
+func (b *BatchableEthClient) resolveMulticall(ctx context.Context, group *ethCallGroup, req rpc.BatchElem) bool {
+	err := req.Error
+	var results []multicall3Result
+	if err == nil {
+		data := *req.Result.(*hexutil.Bytes)
+		if results, err = unpackMulticall(data, len(group.tasks)); err != nil && len(data) == 0 &&
+			!group.tasks[0].archive && b.multicallMissing.CompareAndSwap(false, true) {
+			klog.Warnf(ctx, "BatchableEthClient.batchCalls|multicall3 not deployed, disabling multicall|address=%s",
+				b.multicallAddress)
+		}
+	}
+	if err != nil {
+		klog.Debugf(ctx, "BatchableEthClient.batchCalls|multicall failed, falling back to json-rpc batch|calls=%d|"+
+			"err=%v", len(group.tasks), err)
+		return false
+	}
+	for i, result := range results {
+		task := group.tasks[i]
+		if !result.Success {
+			task.Resolve(nil, &RevertError{Data: result.ReturnData})
+			continue
+		}
+		*task.result.(*hexutil.Bytes) = result.ReturnData
+		task.Resolve(task.result, nil)
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	revertingTarget = common.HexToAddress("0xbad")
+	// revertData is the abi encoding of Error("nope")
+	revertData = hexutil.MustDecode("0x08c379a0000000000000000000000000000000000000000000000000000000000000002" +
+		"000000000000000000000000000000000000000000000000000000000000000046e6f706500000000000000000000000000000000" +
+		"000000000000000000000000")
+)
+
+// newMulticallNode returns a fake node echoing eth_call data, reverting calls to revertingTarget and aggregating calls
+// to Multicall3Address if deployed.
+func newMulticallNode(t *testing.T, deployed bool) *fakeEthNode {
+	ethCall := func(call fakeEthCall) (any, *fakeEthError) {
+		var arg struct {
+			To   common.Address `json:"to"`
+			Data hexutil.Bytes  `json:"data"`
+		}
+		_ = json.Unmarshal(call.Params[0], &arg)
+		switch arg.To {
+		case Multicall3Address:
+			if !deployed {
+				return "0x", nil
+			}
+			in, err := multicall3.Methods["aggregate3"].Inputs.Unpack(arg.Data[4:])
+			if !assert.NoError(t, err) {
+				return nil, &fakeEthError{Code: -32602, Message: err.Error()}
+			}
+			var results []multicall3Result
+			for _, call := range in[0].([]struct {
+				Target       common.Address `json:"target"`
+				AllowFailure bool           `json:"allowFailure"`
+				CallData     []byte         `json:"callData"`
+			}) {
+				if call.Target == revertingTarget {
+					results = append(results, multicall3Result{ReturnData: revertData})
+				} else {
+					results = append(results, multicall3Result{Success: true, ReturnData: call.CallData})
+				}
+			}
+			out, err := multicall3.Methods["aggregate3"].Outputs.Pack(results)
+			assert.NoError(t, err)
+			return hexutil.Bytes(out), nil
+		case revertingTarget:
+			return nil, &fakeEthError{Code: 3, Message: "execution reverted: nope", Data: hexutil.Encode(revertData)}
+		default:
+			return arg.Data, nil
+		}
+	}
+	return newFakeEthNode(t, 1, func(n *fakeEthNode) {
+		n.handlers = map[string]fakeEthHandler{"eth_call": ethCall}
+	})
+}
+
+func newTestBatchableEthClient(t *testing.T, url string, opts ...BatchableEthOption) *BatchableEthClient {
+	ethCli, err := Dial(context.Background(), url)
+	require.NoError(t, err)
+	ethClient := &EthClient{Client: ethCli, Archive: ethCli}
+	client := NewBatchableEthClient(ethClient, func() (time.Duration, int) {
+		return time.Hour, 100
+	}, &backoff.StopBackOff{}, opts...)
+	t.Cleanup(client.Close)
+	return client
+}
+
+// callAll sends msgs concurrently then flushes them in a single batch.
+func callAll(client *BatchableEthClient, msgs []ethereum.CallMsg) ([][]byte, []error) {
+	results, errs := make([][]byte, len(msgs)), make([]error, len(msgs))
+	var wg sync.WaitGroup
+	for i, msg := range msgs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = client.CallContract(context.Background(), msg, nil)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	client.Flush()
+	wg.Wait()
+	return results, errs
+}
+
+func TestBatchableEthClientMulticall(t *testing.T) {
+	target := common.HexToAddress("0x1")
+	msgs := []ethereum.CallMsg{
+		{To: &target, Data: []byte{1}},
+		{To: &target, Data: []byte{2}},
+		{To: &revertingTarget, Data: []byte{3}},
+		{To: &target, Data: []byte{4}, Value: big.NewInt(1)},
+	}
+	for _, deployed := range []bool{true, false} {
+		server := newMulticallNode(t, deployed)
+		client := newTestBatchableEthClient(t, server.URL, WithMulticall(Multicall3Address))
+		results, errs := callAll(client, msgs)
+
+		for i, expected := range [][]byte{{1}, {2}, nil, {4}} {
+			if expected == nil {
+				continue
+			}
+			assert.NoError(t, errs[i])
+			assert.Equal(t, expected, results[i])
+		}
+		require.Error(t, errs[2])
+		assert.Contains(t, errs[2].Error(), "execution reverted: nope")
+		var dataErr rpc.DataError
+		require.ErrorAs(t, errs[2], &dataErr)
+		assert.Equal(t, hexutil.Encode(revertData), dataErr.ErrorData())
+		if deployed {
+			assert.Len(t, server.callsOf("eth_call"), 2, "multicall and call with value")
+		} else {
+			assert.Len(t, server.callsOf("eth_call"), 5, "failed multicall, then each call alone")
+			assert.True(t, client.multicallMissing.Load())
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEthCall is a json-rpc call received by a fakeEthNode.
+type fakeEthCall struct {
+	Id     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// param returns the i-th param of c, unquoted if a string, or "" if missing.
+func (c fakeEthCall) param(i int) string {
+	if i >= len(c.Params) {
+		return ""
+	}
+	var value string
+	if json.Unmarshal(c.Params[i], &value) != nil {
+		return string(c.Params[i])
+	}
+	return value
+}
+
+// fakeEthError is a json-rpc error answered by a fakeEthNode.
+type fakeEthError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data,omitempty"`
+}
+
+// fakeEthHandler answers a json-rpc call with its result, or with an error if not nil.
+type fakeEthHandler func(call fakeEthCall) (any, *fakeEthError)
+
+// fakeEthBlockArgs is the index of the block number param of the methods reading at a block.
+var fakeEthBlockArgs = map[string]int{
+	"eth_getBlockByNumber":    0,
+	"eth_getBalance":          1,
+	"eth_getTransactionCount": 1,
+	"eth_getCode":             1,
+	"eth_call":                1,
+	"eth_getStorageAt":        2,
+}
+
+// fakeEthNode is a fake eth json-rpc node answering single and batch requests. It answers state and block queries at
+// blocks up to its head block, failing like geth for blocks after it and for state pruned before prunedBefore, and
+// records the calls it receives. Handlers override the answers per method.
+type fakeEthNode struct {
+	*httptest.Server
+	head         atomic.Uint64
+	balance      int64                     // balance of all accounts
+	prunedBefore uint64                    // block before which the state is missing
+	rateLimited  atomic.Bool               // whether all calls fail with a rate-limit error
+	handlers     map[string]fakeEthHandler // answers per method overriding the default ones
+	requests     atomic.Int32              // http requests received
+
+	t     *testing.T
+	mu    sync.Mutex
+	calls []fakeEthCall
+}
+
+// newFakeEthNode starts a fakeEthNode at the head block, configured by opts before serving, until the test finishes.
+func newFakeEthNode(t *testing.T, head uint64, opts ...func(*fakeEthNode)) *fakeEthNode {
+	n := &fakeEthNode{t: t}
+	n.head.Store(head)
+	for _, opt := range opts {
+		opt(n)
+	}
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serveHTTP))
+	t.Cleanup(n.Close)
+	return n
+}
+
+func (n *fakeEthNode) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	n.requests.Add(1)
+	body, _ := io.ReadAll(r.Body)
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		var calls []fakeEthCall
+		if !assert.NoError(n.t, json.Unmarshal(body, &calls)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resps := make([]map[string]any, len(calls))
+		for i, call := range calls {
+			resps[i] = n.answer(call)
+		}
+		_ = json.NewEncoder(w).Encode(resps)
+		return
+	}
+	var call fakeEthCall
+	if !assert.NoError(n.t, json.Unmarshal(body, &call)) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(n.answer(call))
+}
+
+// answer records call and returns its json-rpc response.
+func (n *fakeEthNode) answer(call fakeEthCall) map[string]any {
+	n.mu.Lock()
+	n.calls = append(n.calls, call)
+	n.mu.Unlock()
+	result, err := n.handle(call)
+	resp := map[string]any{"jsonrpc": "2.0", "id": call.Id}
+	if err != nil {
+		resp["error"] = err
+	} else {
+		resp["result"] = result
+	}
+	return resp
+}
+
+func (n *fakeEthNode) handle(call fakeEthCall) (any, *fakeEthError) {
+	if n.rateLimited.Load() {
+		return nil, &fakeEthError{Code: -32005, Message: "daily request count exceeded, request rate limited"}
+	}
+	blockNumber := n.head.Load()
+	if i, ok := fakeEthBlockArgs[call.Method]; ok {
+		switch blockArg := call.param(i); blockArg {
+		case "", "latest", "pending", "safe", "finalized":
+		case "earliest":
+			blockNumber = 0
+		default:
+			if blockNumber, _ = hexutil.DecodeUint64(blockArg); blockNumber > n.head.Load() {
+				return nil, &fakeEthError{Code: -32000, Message: "header not found"}
+			}
+			if blockNumber < n.prunedBefore && call.Method != "eth_getBlockByNumber" {
+				return nil, &fakeEthError{Code: -32000, Message: "missing trie node abcd (path )"}
+			}
+		}
+	}
+	if handler, ok := n.handlers[call.Method]; ok {
+		return handler(call)
+	}
+	switch call.Method {
+	case "eth_chainId":
+		return "0x1", nil
+	case "eth_blockNumber":
+		return hexutil.Uint64(n.head.Load()), nil
+	case "eth_getBalance":
+		return (*hexutil.Big)(big.NewInt(n.balance)), nil
+	case "eth_getTransactionCount":
+		return "0x7", nil
+	case "eth_getCode", "eth_getStorageAt":
+		return "0xc0de", nil
+	case "eth_call":
+		var arg struct {
+			Data hexutil.Bytes `json:"data"`
+		}
+		_ = json.Unmarshal(call.Params[0], &arg)
+		return arg.Data, nil
+	case "eth_getBlockByNumber":
+		return fakeEthHeader(blockNumber), nil
+	case "eth_getTransactionReceipt":
+		return nil, nil
+	default:
+		return nil, &fakeEthError{Code: -32601, Message: "the method " + call.Method + " does not exist"}
+	}
+}
+
+// fakeEthHeader returns the json of the header of a block.
+func fakeEthHeader(number uint64) map[string]any {
+	return map[string]any{"number": hexutil.Uint64(number), "parentHash": common.Hash{},
+		"sha3Uncles": common.Hash{}, "miner": common.Address{}, "stateRoot": common.Hash{},
+		"transactionsRoot": common.Hash{}, "receiptsRoot": common.Hash{},
+		"logsBloom": hexutil.Bytes(make([]byte, 256)), "difficulty": "0x0", "gasLimit": "0x0", "gasUsed": "0x0",
+		"timestamp": "0x0", "extraData": "0x"}
+}
+
+// callsOf returns the calls of method received so far.
+func (n *fakeEthNode) callsOf(method string) []fakeEthCall {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var calls []fakeEthCall
+	for _, call := range n.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// methods returns the distinct methods of the calls received so far.
+func (n *fakeEthNode) methods() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var methods []string
+	for _, call := range n.calls {
+		if !slices.Contains(methods, call.Method) {
+			methods = append(methods, call.Method)
+		}
+	}
+	return methods
+}
+
+// blockArgs returns the distinct block number params of the calls of method received so far.
+func (n *fakeEthNode) blockArgs(method string) []string {
+	var blockArgs []string
+	for _, call := range n.callsOf(method) {
+		if blockArg := call.param(fakeEthBlockArgs[method]); !slices.Contains(blockArgs, blockArg) {
+			blockArgs = append(blockArgs, blockArg)
+		}
+	}
+	return blockArgs
+}
+
+// countAt returns the number of calls of method at blockNumber received so far.
+func (n *fakeEthNode) countAt(method string, blockNumber uint64) int {
+	count, blockArg := 0, "0x"+strconv.FormatUint(blockNumber, 16)
+	for _, call := range n.callsOf(method) {
+		if call.param(fakeEthBlockArgs[method]) == blockArg {
+			count++
+		}
+	}
+	return count
+}
+
+// reset forgets the calls received so far.
+func (n *fakeEthNode) reset() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls = nil
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// CallOverrides are the state and block overrides of an eth_call, such as to simulate calls with temporary balances,
+// code or storage.
+type CallOverrides struct {
+	State map[common.Address]ethereum.OverrideAccount // balance, nonce, code, state or stateDiff per account
+	Block *ethereum.BlockOverrides                    // block fields exposed to the evm
+}
+
+// args returns the eth_call params following the block number for o.
+func (o *CallOverrides) args() []any {
+	switch {
+	case o == nil || len(o.State) == 0 && o.Block == nil:
+		return nil
+	case o.Block == nil:
+		return []any{o.State}
+	default:
+		return []any{o.State, o.Block}
+	}
+}
+
+// CallContractWithOverrides executes an eth_call at blockNumber with overrides.
+func (c *EthClient) CallContractWithOverrides(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int,
+	overrides *CallOverrides) ([]byte, error) {
+	return readAt(ctx, c, blockNumber, func(client *ethclient.Client, blockNumber *big.Int) ([]byte, error) {
+		var result hexutil.Bytes
+		err := client.Client().CallContext(ctx, &result, "eth_call",
+			append([]any{toCallArg(msg), toBlockNumArg(blockNumber)}, overrides.args()...)...)
+		return result, err
+	})
+}
+
+// CallContractWithOverrides batches an eth_call at blockNumber with overrides. Calls with overrides are never
+// aggregated by Multicall3, and are cached per overrides.
+func (b *BatchableEthClient) CallContractWithOverrides(ctx context.Context, msg ethereum.CallMsg,
+	blockNumber *big.Int, overrides *CallOverrides) ([]byte, error) {
+	overrideArgs := overrides.args()
+	if len(overrideArgs) == 0 {
+		return b.CallContract(ctx, msg, blockNumber)
+	}
+	return batchCall[hexutil.Bytes](ctx, b, blockNumber, nil, "eth_call",
+		append([]any{toCallArg(msg), latestBlock{}}, overrideArgs...)...)
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallContractWithOverrides(t *testing.T) {
+	klog.Log()
+	server := newFakeEthNode(t, 1000)
+	cfg := &BatchableEthCfg{EthCfg: EthCfg{Url: server.URL}, BatchRate: time.Millisecond, BatchCnt: 100,
+		BackOff: &BackoffCfg{MaxRetries: 1}, Cache: &EthCacheCfg{}}
+	cfg.OnUpdate(nil, cfg)
+	defer cfg.C.Close()
+
+	ctx, account := context.Background(), common.HexToAddress("0x1")
+	msg := ethereum.CallMsg{To: &account}
+	stateOverrides := &CallOverrides{State: map[common.Address]ethereum.OverrideAccount{
+		account: {Balance: big.NewInt(1), StateDiff: map[common.Hash]common.Hash{{1}: {2}}},
+	}}
+	blockOverrides := &CallOverrides{Block: &ethereum.BlockOverrides{Time: 10}}
+	_, err := cfg.C.EthClient.CallContractWithOverrides(ctx, msg, nil, stateOverrides)
+	require.NoError(t, err)
+	for range 2 {
+		for _, overrides := range []*CallOverrides{nil, stateOverrides, blockOverrides} {
+			_, err = cfg.C.CallContractWithOverrides(ctx, msg, big.NewInt(100), overrides)
+			require.NoError(t, err)
+		}
+	}
+
+	stateParams := `[{"0x0000000000000000000000000000000000000001":{"balance":"0x1","stateDiff":` +
+		`{"0x0100000000000000000000000000000000000000000000000000000000000000":` +
+		`"0x0200000000000000000000000000000000000000000000000000000000000000"}}}]`
+	counts := make(map[string]int)
+	for _, call := range server.callsOf("eth_call") {
+		overrides, _ := json.Marshal(call.Params[2:])
+		counts[string(overrides)]++
+	}
+	assert.Equal(t, map[string]int{"[]": 1, stateParams: 2, `[null,{"time":"0xa"}]`: 1}, counts,
+		"calls are cached per overrides")
+}
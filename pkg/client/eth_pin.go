@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/KyberNetwork/kutils"
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultHeadInterval = time.Second
+
+type ctxKeyBlock struct{}
+
+// CtxWithBlock returns ctx pinning the calls of EthClient and BatchableEthClient at the latest block to blockNumber.
+func CtxWithBlock(ctx context.Context, blockNumber *big.Int) context.Context {
+	return context.WithValue(ctx, ctxKeyBlock{}, blockNumber)
+}
+
+// BlockFromCtx returns the block number pinned by CtxWithBlock or EthClient.Snapshot, or nil if none.
+func BlockFromCtx(ctx context.Context) *big.Int {
+	blockNumber, _ := ctx.Value(ctxKeyBlock{}).(*big.Int)
+	return blockNumber
+}
+
+// Snapshot returns ctx pinning calls at the latest block to the current head block, so that all the reads of a logical
+// operation within ctx are at the same block. It returns ctx as is if it is already pinned.
+func (c *EthClient) Snapshot(ctx context.Context) (context.Context, error) {
+	if BlockFromCtx(ctx) != nil {
+		return ctx, nil
+	}
+	head, err := c.Head(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	return CtxWithBlock(ctx, head), nil
+}
+
+// Head returns the head block number of the full node, as tracked if pinning latest calls.
+func (c *EthClient) Head(ctx context.Context) (*big.Int, error) {
+	if head := c.head.get(); head != nil {
+		return head, nil
+	}
+	head, err := c.Client.BlockNumber(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "EthClient.Head")
+	}
+	return new(big.Int).SetUint64(head), nil
+}
+
+// at returns the client and block number to read at blockNumber, pinning the latest block per ctx or the tracked head.
+func (c *EthClient) at(ctx context.Context, blockNumber *big.Int) (*ethclient.Client, *big.Int) {
+	if blockNumber == nil {
+		blockNumber = c.latest(ctx)
+	}
+	return c.clientAt(ctx, blockNumber), blockNumber
+}
+
+// clientAt returns ClientFor(blockNumber), fetching the head block first if needed to route by block age.
+func (c *EthClient) clientAt(ctx context.Context, blockNumber *big.Int) *ethclient.Client {
+	if blockNumber != nil && blockNumber.Sign() >= 0 && c.Archive != c.Client {
+		c.head.fetch(ctx)
+	}
+	return c.ClientFor(blockNumber)
+}
+
+// latest returns the block number to read at instead of the latest block, or nil if not pinned.
+func (c *EthClient) latest(ctx context.Context) *big.Int {
+	if blockNumber := BlockFromCtx(ctx); blockNumber != nil {
+		return blockNumber
+	}
+	if !c.pinLatest {
+		return nil
+	}
+	return c.head.get()
+}
+
+// headTracker tracks the head block number of a node, either polling it every interval once started, or fetching it
+// on demand when its last fetch is older than interval.
+type headTracker struct {
+	client    *ethclient.Client
+	interval  time.Duration
+	head      atomic.Pointer[big.Int]
+	fetchedAt atomic.Int64 // unix nano time of the last on-demand fetch
+	group     singleflight.Group
+	cancel    context.CancelFunc // stops polling, nil if fetching on demand
+}
+
+// newHeadTracker starts tracking the head block of client every interval.
+func newHeadTracker(client *ethclient.Client, interval time.Duration) *headTracker {
+	t := newLazyHeadTracker(client, interval)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	go t.track(ctx)
+	return t
+}
+
+// newLazyHeadTracker returns a tracker fetching the head block of client on demand, at most once per interval.
+func newLazyHeadTracker(client *ethclient.Client, interval time.Duration) *headTracker {
+	if interval <= 0 {
+		interval = defaultHeadInterval
+	}
+	return &headTracker{client: client, interval: interval}
+}
+
+func (t *headTracker) track(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		reqCtx, cancel := context.WithTimeout(ctx, t.interval)
+		head, err := t.client.BlockNumber(reqCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				klog.Warnf(ctx, "headTracker.track|failed to get head block|err=%v", err)
+			}
+		} else if last := t.head.Load(); last == nil || last.Uint64() < head {
+			t.head.Store(new(big.Int).SetUint64(head))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// get returns the tracked head block number, or nil if not tracking, not known yet or last fetched on demand more than
+// interval ago.
+func (t *headTracker) get() *big.Int {
+	if t == nil {
+		return nil
+	}
+	if t.cancel == nil && time.Since(time.Unix(0, t.fetchedAt.Load())) >= t.interval {
+		return nil
+	}
+	return t.head.Load()
+}
+
+// fetch returns the tracked head block number, fetching it first if fetching on demand and its last fetch is older
+// than interval. It returns nil if the head block is not known.
+func (t *headTracker) fetch(ctx context.Context) *big.Int {
+	if head := t.get(); head != nil || t == nil || t.cancel != nil {
+		return head
+	}
+	head, _, _ := t.group.Do("head", func() (any, error) {
+		ctx, cancel := context.WithTimeout(kutils.CtxWithoutCancel(ctx), t.interval)
+		defer cancel()
+		head, err := t.client.BlockNumber(ctx)
+		if err != nil {
+			klog.Warnf(ctx, "headTracker.fetch|failed to get head block|err=%v", err)
+			return (*big.Int)(nil), nil
+		}
+		number := new(big.Int).SetUint64(head)
+		t.head.Store(number)
+		t.fetchedAt.Store(time.Now().UnixNano())
+		return number, nil
+	})
+	return head.(*big.Int)
+}
+
+// Close stops tracking.
+func (t *headTracker) Close() {
+	if t != nil && t.cancel != nil {
+		t.cancel()
+	}
+}
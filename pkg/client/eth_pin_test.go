@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEthClientSnapshot(t *testing.T) {
+	server := newFakeEthNode(t, 10)
+	cfg := &EthCfg{Url: server.URL}
+	cfg.OnUpdate(nil, cfg)
+	defer cfg.C.Close()
+
+	ctx, err := cfg.C.Snapshot(context.Background())
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, BlockFromCtx(ctx).Int64())
+	server.head.Store(11)
+	_, err = cfg.C.BalanceAt(ctx, common.Address{}, nil)
+	require.NoError(t, err)
+	_, err = cfg.C.BalanceAt(context.Background(), common.Address{}, nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"0xa", "latest"}, server.blockArgs("eth_getBalance"))
+
+	ctx2, err := cfg.C.Snapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ctx, ctx2, "already pinned")
+}
+
+func TestBatchableEthClientPinLatest(t *testing.T) {
+	klog.Log()
+	server := newFakeEthNode(t, 10)
+	ethCfg := &EthCfg{Url: server.URL, PinLatest: true, HeadInterval: 10 * time.Millisecond}
+	ethCfg.OnUpdate(nil, ethCfg)
+	client := NewBatchableEthClient(ethCfg.C, func() (time.Duration, int) {
+		return time.Hour, 5
+	}, &backoff.StopBackOff{})
+	defer client.Close()
+	require.Eventually(t, func() bool {
+		return client.head.get() != nil
+	}, time.Second, 10*time.Millisecond)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.BalanceAt(ctx, common.Address{}, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"0xa"}, server.blockArgs("eth_getBalance"), "a batch is pinned to a single block")
+	server.reset()
+
+	server.head.Store(11)
+
+	require.Eventually(t, func() bool {
+		return client.head.get().Uint64() == 11
+	}, time.Second, 10*time.Millisecond)
+	_, err := client.EthClient.BalanceAt(ctx, common.Address{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0xb"}, server.blockArgs("eth_getBalance"))
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+)
+
+// jsonRpcMessage is a json-rpc request or response.
+type jsonRpcMessage struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Error  *jsonRpcError   `json:"error"`
+}
+
+// jsonRpcError is the error of a json-rpc response.
+type jsonRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// parseJsonRpc parses a json-rpc message or batch of messages, returning nil if invalid.
+func parseJsonRpc(body []byte) []jsonRpcMessage {
+	body = bytes.TrimSpace(body)
+	if len(body) != 0 && body[0] == '[' {
+		var msgs []jsonRpcMessage
+		if json.Unmarshal(body, &msgs) != nil {
+			return nil
+		}
+		return msgs
+	}
+	var msg jsonRpcMessage
+	if json.Unmarshal(body, &msg) != nil {
+		return nil
+	}
+	return []jsonRpcMessage{msg}
+}
+
+// jsonRpcMetricsTransport is an http.RoundTripper middleware recording each json-rpc call of a request, including each
+// call of a batch, as an outgoing request via kmetric like other clients, by endpoint as target, node role, json-rpc
+// method and code, i.e. OK, the json-rpc error code, the http status code of a non-200 response or error if failed
+// without a response. The 200 responses are parsed once via readJsonRpcResponse, shared with ethEndpointPool.
+type jsonRpcMetricsTransport struct {
+	base     http.RoundTripper
+	role     string
+	endpoint string
+}
+
+func newJsonRpcMetricsTransport(base http.RoundTripper, role, endpoint string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &jsonRpcMetricsTransport{base: base, role: role, endpoint: endpoint}
+}
+
+func (t *jsonRpcMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.GetBody == nil {
+		return t.base.RoundTrip(req)
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return t.base.RoundTrip(req)
+	}
+	reqBody, err := io.ReadAll(body)
+	_ = body.Close()
+	calls := parseJsonRpc(reqBody)
+	if err != nil || len(calls) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	startTime := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	callCodes := make(map[string]string, len(calls))
+	defaultCode := codeOk
+	switch {
+	case err != nil:
+		defaultCode = codeTransportError
+	case resp.StatusCode != http.StatusOK:
+		defaultCode = strconv.Itoa(resp.StatusCode)
+	default:
+		var results []jsonRpcMessage
+		if results, err = readJsonRpcResponse(resp); err != nil {
+			resp, defaultCode = nil, codeTransportError
+			break
+		}
+		if len(results) == 1 && len(calls) > 1 && results[0].Error != nil {
+			defaultCode = strconv.Itoa(results[0].Error.Code) // error of the whole batch
+		}
+		for _, result := range results {
+			if result.Error != nil {
+				callCodes[string(result.Id)] = strconv.Itoa(result.Error.Code)
+			}
+		}
+	}
+
+	duration, ctx := time.Since(startTime), req.Context()
+	for _, call := range calls {
+		code, ok := callCodes[string(call.Id)]
+		if !ok {
+			code = defaultCode
+		}
+		kmetric.RecordOutgoingRequest(ctx, duration, kmetric.AttrTarget, t.endpoint, kmetric.AttrRole, t.role,
+			kmetric.AttrMethod, call.Method, kmetric.AttrCode, code)
+	}
+	return resp, err
+}
+
+// rpcErrorCode returns the code attribute of a json-rpc call failing with err.
+func rpcErrorCode(err error) string {
+	if err == nil {
+		return codeOk
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return strconv.Itoa(rpcErr.ErrorCode())
+	}
+	return codeTransportError
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric/kmetrictest"
+)
+
+func TestParseJsonRpc(t *testing.T) {
+	msgs := parseJsonRpc([]byte(` [{"id":1,"method":"eth_call"},{"id":2,"error":{"code":-32000}}]`))
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "eth_call", msgs[0].Method)
+	assert.Equal(t, -32000, msgs[1].Error.Code)
+
+	msgs = parseJsonRpc([]byte(`{"id":"a","method":"eth_blockNumber"}`))
+	require.Len(t, msgs, 1)
+	assert.Equal(t, `"a"`, string(msgs[0].Id))
+
+	assert.Nil(t, parseJsonRpc([]byte("not json")))
+}
+
+func TestRpcErrorCode(t *testing.T) {
+	assert.Equal(t, codeOk, rpcErrorCode(nil))
+	assert.Equal(t, "3", rpcErrorCode(errors.Wrap(&RevertError{}, "call")))
+	assert.Equal(t, codeTransportError, rpcErrorCode(errors.New("eof")))
+}
+
+func TestJsonRpcMetricsTransport(t *testing.T) {
+	const respBody = `[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":2,"error":{"code":3}}]`
+	var unavailable atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBody, _ := io.ReadAll(r.Body)
+		assert.Len(t, parseJsonRpc(reqBody), 2)
+		if unavailable.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(respBody))
+	}))
+	defer server.Close()
+	calls := func(method, code string) func() int64 {
+		return kmetrictest.CounterDelta(t, kmetric.OutgoingRequest, attribute.String(kmetric.AttrTarget, "metrics"),
+			attribute.String(kmetric.AttrRole, "full"), attribute.String(kmetric.AttrMethod, method),
+			attribute.String(kmetric.AttrCode, code))
+	}
+	okCalls, revertedCalls := calls("eth_blockNumber", codeOk), calls("eth_call", "3")
+	unavailableCalls, failedCalls := calls("eth_call", "503"), calls("eth_call", codeTransportError)
+
+	c := &http.Client{Transport: newJsonRpcMetricsTransport(nil, "full", "metrics")}
+	post := func() (*http.Response, error) {
+		return c.Post(server.URL, "application/json",
+			strings.NewReader(`[{"id":1,"method":"eth_blockNumber"},{"id":2,"method":"eth_call"}]`))
+	}
+	resp, err := post()
+	require.NoError(t, err)
+	assert.IsType(t, &jsonRpcBody{}, resp.Body, "parsed response is shared with ethEndpointPool")
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, respBody, string(body), "response body is passed through")
+	assert.EqualValues(t, 1, okCalls())
+	assert.EqualValues(t, 1, revertedCalls(), "each call of a batch is recorded with its code")
+
+	unavailable.Store(true)
+	resp, err = post()
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.EqualValues(t, 1, unavailableCalls(), "http status code of a failed batch")
+	server.Close()
+	_, err = post()
+	require.Error(t, err)
+	assert.EqualValues(t, 1, failedCalls())
+}
+
+var (
+	ethSpansOnce sync.Once
+	ethSpans     *tracetest.SpanRecorder
+)
+
+// ethSpanRecorder returns the recorder of the spans of ethTracer, installing a global tracer provider on first call as
+// ethTracer is bound to the first one installed.
+func ethSpanRecorder() *tracetest.SpanRecorder {
+	ethSpansOnce.Do(func() {
+		ethSpans = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(ethSpans)))
+	})
+	return ethSpans
+}
+
+func TestBatchableEthClientTelemetry(t *testing.T) {
+	klog.Log()
+	spans := ethSpanRecorder()
+	server := newFakeEthNode(t, 100)
+	ctx := context.Background()
+	ethClient, err := Dial(ctx, server.URL)
+	require.NoError(t, err)
+	client := NewBatchableEthClient(&EthClient{Client: ethClient, Archive: ethClient}, func() (time.Duration, int) {
+		return time.Hour, 2
+	}, &backoff.StopBackOff{})
+	defer client.Close()
+
+	role := attribute.String(kmetric.AttrRole, "full")
+	batchSizes := kmetrictest.HistogramCountDelta(t, kmetric.EthBatchSize, role)
+	batchSizeSum := kmetrictest.HistogramSum(t, kmetric.EthBatchSize, role)
+	batchCalls := kmetrictest.CounterDelta(t, kmetric.EthBatchCall, role,
+		attribute.String(kmetric.AttrMethod, "eth_getBalance"), attribute.String(kmetric.AttrCode, codeOk))
+	batchWaits := kmetrictest.HistogramCountDelta(t, kmetric.EthBatchWait, role,
+		attribute.String(kmetric.AttrMethod, "eth_getBalance"))
+	rpcCalls := kmetrictest.CounterDelta(t, kmetric.OutgoingRequest,
+		attribute.String(kmetric.AttrTarget, strings.TrimPrefix(server.URL, "http://")),
+		attribute.String(kmetric.AttrMethod, "eth_getBalance"), attribute.String(kmetric.AttrCode, codeOk))
+
+	var wg sync.WaitGroup
+	callers := make([]trace.SpanID, 2)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, span := otel.Tracer("test").Start(ctx, "caller")
+			defer span.End()
+			callers[i] = span.SpanContext().SpanID()
+			_, err := client.BalanceAt(ctx, common.Address{}, big.NewInt(100))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 1, batchSizes())
+	assert.EqualValues(t, 2, kmetrictest.HistogramSum(t, kmetric.EthBatchSize, role)-batchSizeSum)
+	assert.EqualValues(t, 2, batchCalls())
+	assert.EqualValues(t, 2, batchWaits())
+	assert.EqualValues(t, 2, rpcCalls(), "calls of the sent batch are recorded per method")
+
+	var callSpans []sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		if span.Name() == "eth.batch.eth_getBalance" && slices.Contains(callers, span.Parent().SpanID()) {
+			callSpans = append(callSpans, span)
+		}
+	}
+	require.Len(t, callSpans, 2)
+	var batchSpan sdktrace.ReadOnlySpan
+	require.Eventually(t, func() bool {
+		for _, span := range spans.Ended() {
+			if span.Name() == "eth.batch" && slices.ContainsFunc(span.Links(), func(link sdktrace.Link) bool {
+				return link.SpanContext.SpanID() == callSpans[0].SpanContext().SpanID()
+			}) {
+				batchSpan = span
+			}
+		}
+		return batchSpan != nil
+	}, time.Second, time.Millisecond)
+	for _, callSpan := range callSpans {
+		assert.True(t, slices.ContainsFunc(batchSpan.Links(), func(link sdktrace.Link) bool {
+			return link.SpanContext.SpanID() == callSpan.SpanContext().SpanID()
+		}), "batch span is linked to the spans of its calls")
+		assert.True(t, slices.ContainsFunc(callSpan.Links(), func(link sdktrace.Link) bool {
+			return link.SpanContext.SpanID() == batchSpan.SpanContext().SpanID()
+		}), "call spans are linked to the batch span")
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEthClientRouting(t *testing.T) {
+	klog.Log()
+	full := newFakeEthNode(t, 1000, func(n *fakeEthNode) { n.prunedBefore = 950 })
+	archive := newFakeEthNode(t, 1000)
+	cfg := &EthCfg{Url: full.URL, ArchiveUrl: archive.URL, HeadInterval: time.Minute}
+	cfg.OnUpdate(nil, cfg)
+	time.Sleep(30 * time.Millisecond)
+	assert.Empty(t, full.callsOf("eth_blockNumber"), "head block is not polled")
+	ctx := context.Background()
+	assert.Equal(t, cfg.C.Client, cfg.C.clientAt(ctx, big.NewInt(999)))
+	assert.Len(t, full.callsOf("eth_blockNumber"), 1, "head block is fetched on demand")
+
+	for _, tc := range []struct {
+		blockNumber *big.Int
+		archive     bool
+	}{
+		{nil, false},
+		{big.NewInt(999), false},
+		{big.NewInt(873), false},
+		{big.NewInt(872), true},
+		{big.NewInt(int64(rpc.FinalizedBlockNumber)), false},
+		{big.NewInt(int64(rpc.SafeBlockNumber)), false},
+		{big.NewInt(int64(rpc.EarliestBlockNumber)), true},
+	} {
+		assert.Equal(t, tc.archive, cfg.C.ClientFor(tc.blockNumber) == cfg.C.Archive, tc.blockNumber)
+	}
+
+	_, err := cfg.C.BalanceAt(ctx, common.Address{}, big.NewInt(900))
+	require.NoError(t, err)
+	_, err = cfg.C.BalanceAt(ctx, common.Address{}, big.NewInt(960))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"0x384", "0x3c0"}, full.blockArgs("eth_getBalance"))
+	assert.Equal(t, []string{"0x384"}, archive.blockArgs("eth_getBalance"), "missing state is read from the archive node")
+
+	batchable := NewBatchableEthClient(cfg.C, func() (time.Duration, int) {
+		return time.Millisecond, 100
+	}, &backoff.StopBackOff{})
+	defer batchable.Close()
+	full.reset()
+	archive.reset()
+	_, err = batchable.BalanceAt(ctx, common.Address{}, big.NewInt(901))
+	require.NoError(t, err)
+	_, err = batchable.BalanceAt(ctx, common.Address{}, big.NewInt(100))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0x385"}, full.blockArgs("eth_getBalance"))
+	assert.ElementsMatch(t, []string{"0x385", "0x64"}, archive.blockArgs("eth_getBalance"))
+}
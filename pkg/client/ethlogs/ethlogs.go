@@ -0,0 +1,370 @@
+// Package ethlogs provides reorg-aware subscriptions to eth logs on top of client.EthClient, for indexers to process
+// the logs matching a filter exactly once per canonical block, checkpointing their progress in a Store.
+package ethlogs
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/KyberNetwork/service-framework/pkg/client"
+)
+
+const (
+	defaultPollInterval  = 5 * time.Second
+	defaultMaxRange      = 2000
+	defaultMaxReorgDepth = 128
+
+	maxConcurrentHeaders = 32 // max concurrent header calls to check log hashes, batched by client.BatchableEthClient
+)
+
+// Client is the subset of client.EthClient used by subscriptions. With a client.BatchableEthClient, the header calls
+// checking the hashes of logs are batched.
+type Client interface {
+	Head(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+}
+
+var _ Client = (*client.EthClient)(nil)
+
+// Handler processes logs in block order. Logs of blocks reorged out are passed again with Removed set, newest first.
+// The logs are passed again after a restart if the handler or the checkpoint saving fails, so it should be idempotent.
+type Handler func(ctx context.Context, logs []types.Log) error
+
+// Config configures a Subscription.
+type Config struct {
+	// Query filters logs by addresses and topics. FromBlock is the block to start from without checkpoint, default
+	// the latest confirmed block. ToBlock and BlockHash are ignored.
+	Query ethereum.FilterQuery
+	// Confirmations is the number of blocks behind the head block to wait before processing a block. Reorgs deeper
+	// than that are handled with removal events.
+	Confirmations uint64
+	PollInterval  time.Duration // interval of polling for new blocks, default 5s
+	Subscribe     bool          // whether to also poll on new heads via eth_subscribe, for websocket urls
+	MaxRange      uint64        // max blocks per eth_getLogs, halved on too many results errors, default 2000
+	MaxReorgDepth uint64        // number of recent blocks checked for reorgs, default 128
+}
+
+func (c Config) withDefaults() Config {
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	if c.MaxRange == 0 {
+		c.MaxRange = defaultMaxRange
+	}
+	if c.MaxReorgDepth == 0 {
+		c.MaxReorgDepth = defaultMaxReorgDepth
+	}
+	return c
+}
+
+// Subscription polls the logs matching a filter in bounded block ranges, passing them to a handler once confirmed and
+// checkpointing its progress. It detects reorgs by comparing the hashes of recent processed blocks with the canonical
+// ones, rewinding to the last canonical one and passing the logs of reorged blocks as removed. Only the hashes of the
+// recent processed blocks are kept in the checkpoint: the logs of reorged blocks are fetched again by block hash, so
+// that reorgs while not running are also passed as removed.
+type Subscription struct {
+	client  Client
+	store   Store
+	key     string
+	cfg     Config
+	handler Handler
+
+	checkpoint *Checkpoint
+	rangeSize  uint64 // current max blocks per eth_getLogs
+}
+
+// New returns a subscription to the logs of ethClient per cfg, checkpointed in store at key.
+func New(ethClient Client, store Store, key string, cfg Config, handler Handler) *Subscription {
+	cfg = cfg.withDefaults()
+	return &Subscription{
+		client:    ethClient,
+		store:     store,
+		key:       key,
+		cfg:       cfg,
+		handler:   handler,
+		rangeSize: cfg.MaxRange,
+	}
+}
+
+// Run processes logs until ctx is done. Errors are logged and retried at the next poll.
+func (s *Subscription) Run(ctx context.Context) error {
+	var heads chan *types.Header
+	if s.cfg.Subscribe {
+		heads = make(chan *types.Header, 1)
+		sub, err := s.client.SubscribeNewHead(ctx, heads)
+		if err != nil {
+			klog.Warnf(ctx, "Subscription.Run|failed to subscribe to new heads, polling only|key=%s|err=%v", s.key,
+				err)
+			heads = nil
+		} else {
+			defer sub.Unsubscribe()
+		}
+	}
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		caughtUp, err := s.Poll(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			klog.Warnf(ctx, "Subscription.Run|poll failed|key=%s|err=%v", s.key, err)
+		} else if !caughtUp {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-heads:
+		}
+	}
+}
+
+// Poll processes the next range of confirmed blocks, or handles a reorg if any, returning whether it caught up with
+// the latest confirmed block.
+func (s *Subscription) Poll(ctx context.Context) (bool, error) {
+	if s.checkpoint == nil {
+		if err := s.loadCheckpoint(ctx); err != nil {
+			return false, err
+		}
+	}
+	head, err := s.client.Head(ctx)
+	if err != nil {
+		return false, err
+	}
+	if head.Uint64() < s.cfg.Confirmations {
+		return true, nil
+	}
+	target := head.Uint64() - s.cfg.Confirmations
+	if s.checkpoint == nil {
+		s.checkpoint = &Checkpoint{Block: max(target, 1) - 1}
+	}
+	if reorged, err := s.handleReorg(ctx); err != nil || reorged {
+		return false, err
+	}
+
+	from := s.checkpoint.Block + 1
+	if from > target {
+		return true, nil
+	}
+	to := min(target, from+s.rangeSize-1)
+	query := s.cfg.Query
+	query.FromBlock, query.ToBlock, query.BlockHash = new(big.Int).SetUint64(from), new(big.Int).SetUint64(to), nil
+	logs, err := s.client.FilterLogs(ctx, query)
+	if err != nil {
+		if isTooManyResults(err) && to > from {
+			s.rangeSize = max((to-from+1)/2, 1)
+			klog.Debugf(ctx, "Subscription.Poll|too many results, splitting range|key=%s|from=%d|to=%d", s.key,
+				from, to)
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "Subscription.Poll|filter logs %d-%d", from, to)
+	}
+	tip, err := s.checkHashes(ctx, to, logs)
+	if err != nil {
+		return false, err
+	}
+
+	if len(logs) != 0 {
+		if err = s.handler(ctx, logs); err != nil {
+			return false, errors.Wrapf(err, "Subscription.Poll|handle logs %d-%d", from, to)
+		}
+	}
+	s.advance(to, tip, logs)
+	if err = s.store.Save(ctx, s.key, s.checkpoint); err != nil {
+		return false, err
+	}
+	s.rangeSize = min(s.rangeSize*2, s.cfg.MaxRange)
+	return to == target, nil
+}
+
+// loadCheckpoint loads the checkpoint of s, or starts from the FromBlock of the query if none.
+func (s *Subscription) loadCheckpoint(ctx context.Context) error {
+	checkpoint, err := s.store.Load(ctx, s.key)
+	if err != nil {
+		return err
+	}
+	if checkpoint == nil && s.cfg.Query.FromBlock != nil {
+		checkpoint = &Checkpoint{Block: max(s.cfg.Query.FromBlock.Uint64(), 1) - 1}
+	}
+	s.checkpoint = checkpoint
+	return nil
+}
+
+// checkHashes checks that the logs of the blocks tracked for reorgs are of the canonical blocks, returning the ref of
+// block to. Older blocks of the range are deeper than reorgs handled by s, so their logs are not checked. The headers
+// are fetched concurrently, to be batched by a client.BatchableEthClient.
+func (s *Subscription) checkHashes(ctx context.Context, to uint64, logs []types.Log) (BlockRef, error) {
+	numbers := slices.DeleteFunc(logBlocks(logs), func(number uint64) bool {
+		return number == to || number+s.cfg.MaxReorgDepth <= to
+	})
+	numbers = append(numbers, to)
+	hashes := make([]common.Hash, len(numbers))
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentHeaders)
+	for i, number := range numbers {
+		g.Go(func() error {
+			header, err := s.client.HeaderByNumber(gCtx, new(big.Int).SetUint64(number))
+			if err != nil {
+				return errors.Wrapf(err, "Subscription.checkHashes|get header %d", number)
+			}
+			hashes[i] = header.Hash()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return BlockRef{}, err
+	}
+	for _, log := range logs {
+		if i := slices.Index(numbers, log.BlockNumber); i >= 0 && log.BlockHash != hashes[i] {
+			return BlockRef{}, errors.Errorf("Subscription.checkHashes|block %d reorged while polling",
+				log.BlockNumber)
+		}
+	}
+	return BlockRef{Number: to, Hash: hashes[len(hashes)-1]}, nil
+}
+
+// logBlocks returns the distinct block numbers of logs, in order.
+func logBlocks(logs []types.Log) []uint64 {
+	var numbers []uint64
+	for _, log := range logs {
+		if n := len(numbers); n == 0 || numbers[n-1] != log.BlockNumber {
+			numbers = append(numbers, log.BlockNumber)
+		}
+	}
+	return numbers
+}
+
+// advance records the processing of the blocks up to tip with logs.
+func (s *Subscription) advance(to uint64, tip BlockRef, logs []types.Log) {
+	checkpoint := s.checkpoint
+	for _, log := range logs {
+		if n := len(checkpoint.Blocks); n == 0 || checkpoint.Blocks[n-1].Number != log.BlockNumber {
+			checkpoint.Blocks = append(checkpoint.Blocks, BlockRef{Number: log.BlockNumber, Hash: log.BlockHash})
+		}
+	}
+	if n := len(checkpoint.Blocks); n == 0 || checkpoint.Blocks[n-1].Number != to {
+		checkpoint.Blocks = append(checkpoint.Blocks, tip)
+	}
+	checkpoint.Block = to
+
+	if to < s.cfg.MaxReorgDepth {
+		return
+	}
+	oldest := to - s.cfg.MaxReorgDepth
+	checkpoint.Blocks = slices.DeleteFunc(checkpoint.Blocks, func(ref BlockRef) bool {
+		return ref.Number <= oldest
+	})
+}
+
+// handleReorg checks whether the last processed block was reorged. If so, it passes the logs of reorged blocks as
+// removed and rewinds to the last canonical processed block.
+func (s *Subscription) handleReorg(ctx context.Context) (bool, error) {
+	blocks := s.checkpoint.Blocks
+	if len(blocks) == 0 {
+		return false, nil
+	}
+	if canonical, err := s.isCanonical(ctx, blocks[len(blocks)-1]); err != nil || canonical {
+		return false, err
+	}
+
+	ancestor, kept := max(blocks[0].Number, 1)-1, 0
+	for i := len(blocks) - 2; i >= 0; i-- {
+		canonical, err := s.isCanonical(ctx, blocks[i])
+		if err != nil {
+			return false, err
+		}
+		if canonical {
+			ancestor, kept = blocks[i].Number, i+1
+			break
+		}
+	}
+	if kept == 0 {
+		klog.Errorf(ctx, "Subscription.handleReorg|reorg deeper than tracked blocks|key=%s|from=%d", s.key,
+			blocks[0].Number)
+	}
+	klog.Warnf(ctx, "Subscription.handleReorg|reorg detected|key=%s|block=%d|ancestor=%d", s.key, s.checkpoint.Block,
+		ancestor)
+
+	var removed []types.Log
+	for _, ref := range slices.Backward(blocks[kept:]) {
+		logs, err := s.reorgedLogs(ctx, ref)
+		if err != nil {
+			return false, err
+		}
+		for _, log := range slices.Backward(logs) {
+			log.Removed = true
+			removed = append(removed, log)
+		}
+	}
+	if len(removed) != 0 {
+		if err := s.handler(ctx, removed); err != nil {
+			return false, errors.Wrapf(err, "Subscription.handleReorg|handle removed logs after %d", ancestor)
+		}
+	}
+	s.checkpoint.Block, s.checkpoint.Blocks = ancestor, blocks[:kept]
+	return true, s.store.Save(ctx, s.key, s.checkpoint)
+}
+
+// reorgedLogs fetches the logs of a reorged block by its hash. If the node no longer knows the block, its logs cannot
+// be passed as removed and are skipped.
+func (s *Subscription) reorgedLogs(ctx context.Context, ref BlockRef) ([]types.Log, error) {
+	query := s.cfg.Query
+	query.FromBlock, query.ToBlock, query.BlockHash = nil, nil, &ref.Hash
+	logs, err := s.client.FilterLogs(ctx, query)
+	if errors.Is(err, ethereum.NotFound) || err != nil && strings.Contains(err.Error(), "unknown block") {
+		klog.Errorf(ctx, "Subscription.reorgedLogs|reorged block not found, its logs are not removed|key=%s|"+
+			"block=%d|hash=%s", s.key, ref.Number, ref.Hash)
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Subscription.reorgedLogs|filter logs of block %d", ref.Number)
+	}
+	return logs, nil
+}
+
+// isCanonical checks whether ref is still in the canonical chain.
+func (s *Subscription) isCanonical(ctx context.Context, ref BlockRef) (bool, error) {
+	header, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(ref.Number))
+	if errors.Is(err, ethereum.NotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "Subscription.isCanonical|get header %d", ref.Number)
+	}
+	return header.Hash() == ref.Hash, nil
+}
+
+// tooManyResultsErrs are the error messages of rpc nodes and providers for eth_getLogs ranges with too many results or
+// blocks, such as "query returned more than 10000 results" of geth or "Log response size exceeded" of Alchemy.
+var tooManyResultsErrs = []string{"query returned more than", "response size exceeded", "query exceeds max",
+	"block range is too", "block range too", "exceed maximum block range", "block range limit exceeded",
+	"eth_getlogs is limited to"}
+
+// isTooManyResults checks whether err is due to an eth_getLogs range with too many results, unlike rate limits.
+func isTooManyResults(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, tooManyResultsErr := range tooManyResultsErrs {
+		if strings.Contains(msg, tooManyResultsErr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package ethlogs
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChain is an in-memory chain with a log per block in logBlocks, failing eth_getLogs of more than maxRange blocks.
+type fakeChain struct {
+	mu         sync.Mutex
+	headers    []*types.Header
+	byHash     map[common.Hash]*types.Header // all headers, including reorged ones
+	maxRange   uint64
+	ranges     [][2]uint64
+	staleBlock uint64 // block whose logs are answered with the hash of another fork, if not 0
+}
+
+func newFakeChain(length int, fork byte, logBlocks ...uint64) *fakeChain {
+	c := &fakeChain{byHash: make(map[common.Hash]*types.Header)}
+	c.extend(length, fork, logBlocks...)
+	return c
+}
+
+// extend truncates the chain to length blocks or extends it to length blocks of fork, with a log in logBlocks.
+func (c *fakeChain) extend(length int, fork byte, logBlocks ...uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.headers = c.headers[:min(len(c.headers), length)]
+	for number := len(c.headers); number < length; number++ {
+		header := &types.Header{Number: big.NewInt(int64(number)), Extra: []byte{fork}, Difficulty: big.NewInt(0)}
+		if number > 0 {
+			header.ParentHash = c.headers[number-1].Hash()
+		}
+		for _, logBlock := range logBlocks {
+			if logBlock == uint64(number) {
+				header.Bloom[0] = 1 // marks a log
+			}
+		}
+		c.headers = append(c.headers, header)
+		c.byHash[header.Hash()] = header
+	}
+}
+
+func (c *fakeChain) Head(context.Context) (*big.Int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return big.NewInt(int64(len(c.headers) - 1)), nil
+}
+
+func (c *fakeChain) HeaderByNumber(_ context.Context, number *big.Int) (*types.Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if number.Uint64() >= uint64(len(c.headers)) {
+		return nil, ethereum.NotFound
+	}
+	return c.headers[number.Uint64()], nil
+}
+
+func (c *fakeChain) FilterLogs(_ context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if query.BlockHash != nil {
+		header, ok := c.byHash[*query.BlockHash]
+		if !ok {
+			return nil, errors.New("unknown block")
+		}
+		var logs []types.Log
+		if header.Bloom[0] == 1 {
+			logs = append(logs, types.Log{BlockNumber: header.Number.Uint64(), BlockHash: header.Hash(),
+				Data: header.Extra})
+		}
+		return logs, nil
+	}
+	from, to := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+	if c.maxRange != 0 && to-from+1 > c.maxRange {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+	c.ranges = append(c.ranges, [2]uint64{from, to})
+	var logs []types.Log
+	for number := from; number <= to && number < uint64(len(c.headers)); number++ {
+		if header := c.headers[number]; header.Bloom[0] == 1 {
+			log := types.Log{BlockNumber: number, BlockHash: header.Hash(), Data: header.Extra}
+			if number == c.staleBlock {
+				log.BlockHash = common.Hash{1}
+			}
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func (c *fakeChain) SubscribeNewHead(context.Context, chan<- *types.Header) (ethereum.Subscription, error) {
+	return nil, errors.New("notifications not supported")
+}
+
+// logRecorder records handled logs as block numbers, negative if removed.
+type logRecorder struct {
+	blocks []int64
+}
+
+func (r *logRecorder) handle(_ context.Context, logs []types.Log) error {
+	for _, log := range logs {
+		if log.Removed {
+			r.blocks = append(r.blocks, -int64(log.BlockNumber))
+		} else {
+			r.blocks = append(r.blocks, int64(log.BlockNumber))
+		}
+	}
+	return nil
+}
+
+// pollAll polls until caught up.
+func pollAll(t *testing.T, sub *Subscription) {
+	for range 100 {
+		caughtUp, err := sub.Poll(context.Background())
+		require.NoError(t, err)
+		if caughtUp {
+			return
+		}
+	}
+	t.Fatal("not caught up")
+}
+
+func TestSubscription(t *testing.T) {
+	chain := newFakeChain(20, 1, 5, 12, 18)
+	chain.maxRange = 4
+	store := NewMemoryStore()
+	var recorder logRecorder
+	cfg := Config{Query: ethereum.FilterQuery{FromBlock: big.NewInt(1)}, Confirmations: 3, MaxRange: 100}
+	sub := New(chain, store, "test", cfg, recorder.handle)
+
+	pollAll(t, sub)
+	assert.Equal(t, []int64{5, 12}, recorder.blocks, "confirmed logs only")
+	for _, r := range chain.ranges {
+		assert.LessOrEqual(t, r[1]-r[0]+1, uint64(4), "ranges are split")
+	}
+	checkpoint, err := store.Load(context.Background(), "test")
+	require.NoError(t, err)
+	assert.EqualValues(t, 16, checkpoint.Block)
+
+	chain.extend(10, 2)
+	chain.extend(25, 2, 11, 13)
+	pollAll(t, sub)
+	assert.Equal(t, []int64{5, 12, -12, 11, 13}, recorder.blocks, "reorged logs are removed")
+
+	var restarted logRecorder
+	chain.extend(32, 2, 27)
+	pollAll(t, New(chain, store, "test", cfg, restarted.handle))
+	assert.Equal(t, []int64{27}, restarted.blocks, "resumes from checkpoint")
+
+	restarted.blocks = nil
+	chain.extend(26, 2)
+	chain.extend(34, 3, 29)
+	pollAll(t, New(chain, store, "test", cfg, restarted.handle))
+	assert.Equal(t, []int64{-27, 29}, restarted.blocks, "logs reorged while not running are removed")
+}
+
+func TestSubscriptionStart(t *testing.T) {
+	chain := newFakeChain(20, 1, 10, 16)
+	var recorder logRecorder
+	sub := New(chain, NewMemoryStore(), "test", Config{Confirmations: 3}, recorder.handle)
+	pollAll(t, sub)
+	assert.Equal(t, []int64{16}, recorder.blocks, "starts at the latest confirmed block")
+
+	chain.extend(28, 1, 21, 23)
+	chain.staleBlock = 21
+	_, err := sub.Poll(context.Background())
+	assert.Error(t, err, "logs of a block before the end of the range are checked")
+	assert.Equal(t, []int64{16}, recorder.blocks)
+	chain.staleBlock = 0
+	pollAll(t, sub)
+	assert.Equal(t, []int64{16, 21, 23}, recorder.blocks)
+}
+
+func TestIsTooManyResults(t *testing.T) {
+	assert.True(t, isTooManyResults(errors.New("query returned more than 10000 results")))
+	assert.True(t, isTooManyResults(errors.New("Log response size exceeded. You can make eth_getLogs requests with "+
+		"up to a 2K block range")))
+	assert.True(t, isTooManyResults(errors.New("exceed maximum block range: 5000")))
+	assert.False(t, isTooManyResults(rpc.HTTPError{StatusCode: http.StatusTooManyRequests,
+		Status: "429 Too Many Requests", Body: []byte("query returned more than")}))
+	assert.False(t, isTooManyResults(errors.New("daily request count exceeded, request rate limited")))
+	assert.False(t, isTooManyResults(errors.New("rate limit exceeded")))
+}
+
+func TestRedisStore(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: redisServer.Addr()}), "")
+	ctx := context.Background()
+	checkpoint, err := store.Load(ctx, "test")
+	require.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	saved := &Checkpoint{Block: 10, Blocks: []BlockRef{{Number: 10, Hash: common.Hash{1}}}}
+	require.NoError(t, store.Save(ctx, "test", saved))
+	checkpoint, err = store.Load(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, saved, checkpoint)
+	assert.True(t, redisServer.Exists("ethlogs:test"))
+}
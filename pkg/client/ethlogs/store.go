@@ -0,0 +1,99 @@
+package ethlogs
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultRedisPrefix = "ethlogs:"
+
+// Checkpoint is the progress of a Subscription.
+type Checkpoint struct {
+	Block  uint64     `json:"block"`  // last processed block
+	Blocks []BlockRef `json:"blocks"` // recent processed blocks with logs or ending a range, oldest first
+}
+
+// BlockRef is the number and hash of a block.
+type BlockRef struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+}
+
+// Store persists the checkpoints of subscriptions by key.
+type Store interface {
+	// Load returns the checkpoint of key, or nil if none.
+	Load(ctx context.Context, key string) (*Checkpoint, error)
+	// Save saves the checkpoint of key.
+	Save(ctx context.Context, key string, checkpoint *Checkpoint) error
+}
+
+// MemoryStore is an in-memory Store, such as for tests or subscriptions that can restart from their start block.
+type MemoryStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{checkpoints: make(map[string]Checkpoint)}
+}
+
+func (s *MemoryStore) Load(_ context.Context, key string) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkpoint, ok := s.checkpoints[key]
+	if !ok {
+		return nil, nil
+	}
+	checkpoint.Blocks = append([]BlockRef(nil), checkpoint.Blocks...)
+	return &checkpoint, nil
+}
+
+func (s *MemoryStore) Save(_ context.Context, key string, checkpoint *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *checkpoint
+	saved.Blocks = append([]BlockRef(nil), checkpoint.Blocks...)
+	s.checkpoints[key] = saved
+	return nil
+}
+
+// RedisStore is a Store saving checkpoints as json in redis, such as the client of a client.RedisCfg.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore returns a RedisStore saving checkpoints at keys with prefix, default ethlogs:.
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Load(ctx context.Context, key string) (*Checkpoint, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "RedisStore.Load|get %s", key)
+	}
+	var checkpoint Checkpoint
+	if err = json.Unmarshal(value, &checkpoint); err != nil {
+		return nil, errors.Wrapf(err, "RedisStore.Load|unmarshal %s", key)
+	}
+	return &checkpoint, nil
+}
+
+func (s *RedisStore) Save(ctx context.Context, key string, checkpoint *Checkpoint) error {
+	value, err := json.Marshal(checkpoint)
+	if err != nil {
+		return errors.Wrapf(err, "RedisStore.Save|marshal %s", key)
+	}
+	return errors.Wrapf(s.client.Set(ctx, s.prefix+key, value, 0).Err(), "RedisStore.Save|set %s", key)
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"time"
 
-	"github.com/KyberNetwork/kutils/klog"
 	"google.golang.org/grpc"
 
 	"github.com/KyberNetwork/service-framework/pkg/client/grpcclient"
@@ -15,8 +14,12 @@ const GrpcCloseDelay = time.Minute
 // GrpcCfg is hotcfg for grpc client. On update, it
 // creates a new grpc client with the provided factory generated by grpc using service proto.
 // The client has interceptors for adding client id header, validating requests, adding timeout, metrics and tracing.
+// If only Endpoints change, the existing connection is kept and switched to the new endpoints.
+// Otherwise, the new client must become ready within Reload.ValidateTimeout to replace the previous one, which is
+// closed once drained per Reload.
 type GrpcCfg[T any] struct {
 	grpcclient.Config `mapstructure:",squash"`
+	Reload            ReloadCfg
 	C                 T // the inner grpc client
 
 	clientFactory func(grpc.ClientConnInterface) T // must be provided by user, generated from proto file
@@ -31,22 +34,57 @@ func (c *GrpcCfg[T]) WithFactory(clientFactory func(grpc.ClientConnInterface) T)
 
 func (*GrpcCfg[T]) OnUpdate(old, new *GrpcCfg[T]) {
 	ctx := context.Background()
-
+	var oldGrpcClient *grpcclient.Client[T]
 	if old != nil {
-		oldGrpcClient := old.grpcClient
-		time.AfterFunc(GrpcCloseDelay, func() {
-			if err := oldGrpcClient.Close(); err != nil {
-				klog.Errorf(ctx, "GrpcCfg.OnUpdate|old.grpcClient.Close() failed|err=%v", err)
-			}
-		})
+		oldGrpcClient = old.grpcClient
+	}
+
+	// compare with the config of the running client, which old kept if its own reload failed
+	if oldGrpcClient != nil && oldGrpcClient.Cfg.CanUpdateEndpoints(&new.Config) {
+		if err := oldGrpcClient.UpdateEndpoints(new.Endpoints); err == nil {
+			recordReload(ctx, new.name(), nil, old.name())
+			new.grpcClient, new.C = oldGrpcClient, old.C
+			return
+		}
 	}
 
-	var err error
-	new.grpcClient, err = grpcclient.New(new.clientFactory, grpcclient.WithConfig(&new.Config))
+	grpcClient, err := new.dial(ctx, oldGrpcClient != nil)
+	recordReload(ctx, new.name(), err, old.name())
 	if err != nil {
-		klog.Errorf(ctx, "GrpcCfg.OnUpdate|grpcclient.New failed|err=%v", err)
+		if oldGrpcClient != nil {
+			new.grpcClient, new.C = oldGrpcClient, old.C
+		}
 		return
 	}
 
-	new.C = new.grpcClient.C
+	new.grpcClient, new.C = grpcClient, grpcClient.C
+	if oldGrpcClient != nil {
+		drain(ctx, old.name(), new.Reload.drainTimeout(GrpcCloseDelay), oldGrpcClient.InFlight, oldGrpcClient.Close)
+	}
+}
+
+// dial creates a new grpc client, waiting for it to be ready if validate.
+func (c *GrpcCfg[T]) dial(ctx context.Context, validate bool) (*grpcclient.Client[T], error) {
+	grpcClient, err := grpcclient.New(c.clientFactory, grpcclient.WithConfig(&c.Config))
+	if err != nil || !validate {
+		return grpcClient, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.Reload.validateTimeout())
+	defer cancel()
+	if err = grpcClient.WaitForReady(ctx); err != nil {
+		_ = grpcClient.Close()
+		return nil, err
+	}
+	return grpcClient, nil
+}
+
+func (c *GrpcCfg[T]) name() string {
+	if c == nil {
+		return ""
+	}
+	target := c.BaseURL
+	if len(c.Endpoints) != 0 {
+		target = c.Endpoints[0].Addr
+	}
+	return "GrpcCfg " + target
 }
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/KyberNetwork/service-framework/pkg/client/grpcclient"
+)
+
+func TestGrpcCfgReload(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	newCfg := func(addr string, timeout time.Duration) *GrpcCfg[grpc.ClientConnInterface] {
+		cfg := &GrpcCfg[grpc.ClientConnInterface]{Reload: ReloadCfg{ValidateTimeout: 100 * time.Millisecond}}
+		cfg.Endpoints, cfg.Insecure, cfg.Timeout = []grpcclient.Endpoint{{Addr: addr}}, true, timeout
+		return cfg.WithFactory(func(cc grpc.ClientConnInterface) grpc.ClientConnInterface { return cc })
+	}
+
+	cfg1 := newCfg(listener.Addr().String(), time.Second)
+	cfg1.OnUpdate(nil, cfg1)
+	require.NotNil(t, cfg1.grpcClient)
+
+	cfg2 := newCfg("127.0.0.1:1", time.Minute)
+	cfg2.OnUpdate(cfg1, cfg2)
+	assert.Same(t, cfg1.grpcClient, cfg2.grpcClient, "previous client is kept if the new one is not ready")
+	assert.Error(t, ReloadHealth())
+
+	cfg3 := newCfg(listener.Addr().String(), time.Minute)
+	cfg3.OnUpdate(cfg2, cfg3)
+	assert.NotSame(t, cfg1.grpcClient, cfg3.grpcClient, "kept client has a different timeout than cfg2")
+	assert.Equal(t, time.Minute, cfg3.grpcClient.Cfg.Timeout)
+	assert.NoError(t, ReloadHealth())
+
+	cfg4 := newCfg(listener.Addr().String(), time.Minute)
+	cfg4.Endpoints = append(cfg4.Endpoints, grpcclient.Endpoint{Addr: "127.0.0.1:1"})
+	cfg4.OnUpdate(cfg3, cfg4)
+	assert.Same(t, cfg3.grpcClient, cfg4.grpcClient, "only endpoints are updated")
+	assert.Equal(t, cfg4.Endpoints, cfg4.grpcClient.Endpoints())
+	assert.NoError(t, ReloadHealth())
+}
@@ -0,0 +1,153 @@
+package grpcclient
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/balancer/leastrequest"
+	"google.golang.org/grpc/balancer/pickfirst"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+type Balancer string
+
+const (
+	// DefaultBalancer uses PickFirstBalancer for a single target, or RoundRobinBalancer for Endpoints.
+	DefaultBalancer Balancer = ""
+	// PickFirstBalancer sends all calls to the first reachable backend.
+	PickFirstBalancer Balancer = pickfirst.Name
+	// RoundRobinBalancer spreads calls evenly over all reachable backends.
+	RoundRobinBalancer Balancer = roundrobin.Name
+	// LeastRequestBalancer sends calls to the backend with the fewest outstanding calls out of 2 random ones.
+	LeastRequestBalancer Balancer = "least_request"
+	// WeightedBalancer spreads calls randomly over reachable Endpoints proportionally to their Weight.
+	WeightedBalancer Balancer = "weighted"
+)
+
+const (
+	endpointsScheme      = "endpoints"
+	weightedBalancerName = "kyber_weighted_random"
+)
+
+// Endpoint is a backend address to balance calls to.
+type Endpoint struct {
+	Addr   string
+	Weight uint32 // relative weight for WeightedBalancer, default 1
+}
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(weightedBalancerName, weightedPickerBuilder{},
+		base.Config{}))
+}
+
+// serviceConfig returns the default service config json selecting the configured balancer.
+func (c *Config) serviceConfig() string {
+	balancerName := string(c.Balancer)
+	switch c.Balancer {
+	case DefaultBalancer:
+		if len(c.Endpoints) == 0 {
+			return ""
+		}
+		balancerName = roundrobin.Name
+	case LeastRequestBalancer:
+		return fmt.Sprintf(`{"loadBalancingConfig":[{%q:{"choiceCount":2}}]}`, leastrequest.Name)
+	case WeightedBalancer:
+		balancerName = weightedBalancerName
+	}
+	return fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, balancerName)
+}
+
+// newEndpointsResolver returns a resolver that resolves to the given endpoints. It is meant to be used by a single
+// grpc.ClientConn with the target endpointsTarget.
+func newEndpointsResolver(endpoints []Endpoint) *manual.Resolver {
+	r := manual.NewBuilderWithScheme(endpointsScheme)
+	r.InitialState(endpointsState(endpoints))
+	return r
+}
+
+const endpointsTarget = endpointsScheme + ":///"
+
+// target returns the target of c for labels: BaseURL, or the comma separated addresses of Endpoints if set.
+func (c *Config) target() string {
+	if len(c.Endpoints) == 0 {
+		return c.BaseURL
+	}
+	addrs := make([]string, len(c.Endpoints))
+	for i, endpoint := range c.Endpoints {
+		addrs[i] = endpoint.Addr
+	}
+	return endpointsTarget + strings.Join(addrs, ",")
+}
+
+// endpointsState converts endpoints to a resolver state, with weights in address attributes.
+func endpointsState(endpoints []Endpoint) resolver.State {
+	addrs := make([]resolver.Address, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.Addr = strings.TrimSpace(endpoint.Addr); endpoint.Addr == "" {
+			continue
+		}
+		weight := endpoint.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		addrs = append(addrs, resolver.Address{
+			Addr:       endpoint.Addr,
+			Attributes: attributes.New(weightAttrKey{}, weight),
+		})
+	}
+	return resolver.State{Addresses: addrs}
+}
+
+type weightAttrKey struct{}
+
+func weightFromAddr(addr resolver.Address) uint32 {
+	if weight, ok := addr.Attributes.Value(weightAttrKey{}).(uint32); ok && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// weightedPickerBuilder builds pickers choosing ready SubConns randomly proportionally to their weights.
+type weightedPickerBuilder struct{}
+
+func (weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	picker := &weightedPicker{
+		subConns:     make([]balancer.SubConn, 0, len(info.ReadySCs)),
+		cumulWeights: make([]uint64, 0, len(info.ReadySCs)),
+	}
+	for subConn, subConnInfo := range info.ReadySCs {
+		picker.totalWeight += uint64(weightFromAddr(subConnInfo.Address))
+		picker.subConns = append(picker.subConns, subConn)
+		picker.cumulWeights = append(picker.cumulWeights, picker.totalWeight)
+	}
+	return picker
+}
+
+type weightedPicker struct {
+	subConns     []balancer.SubConn
+	cumulWeights []uint64
+	totalWeight  uint64
+}
+
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	target := rand.Uint64N(p.totalWeight)
+	lo, hi := 0, len(p.cumulWeights)-1
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if p.cumulWeights[mid] > target {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return balancer.PickResult{SubConn: p.subConns[lo]}, nil
+}
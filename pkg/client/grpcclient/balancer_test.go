@@ -0,0 +1,129 @@
+package grpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func TestWeightedPicker(t *testing.T) {
+	_, err := weightedPickerBuilder{}.Build(base.PickerBuildInfo{}).Pick(balancer.PickInfo{})
+	assert.ErrorIs(t, err, balancer.ErrNoSubConnAvailable)
+
+	readySCs := make(map[balancer.SubConn]base.SubConnInfo)
+	for addr, weight := range map[string]uint32{"a": 1, "b": 3, "c": 0} {
+		readySCs[&fakeSubConn{addr: addr}] = base.SubConnInfo{Address: resolver.Address{
+			Addr: addr, Attributes: attributes.New(weightAttrKey{}, weight)}}
+	}
+	picker := weightedPickerBuilder{}.Build(base.PickerBuildInfo{ReadySCs: readySCs})
+	const picks = 10000
+	counts := make(map[string]int)
+	for range picks {
+		result, err := picker.Pick(balancer.PickInfo{})
+		require.NoError(t, err)
+		counts[result.SubConn.(*fakeSubConn).addr]++
+	}
+	assert.InDelta(t, 0.2, float64(counts["a"])/picks, 0.03)
+	assert.InDelta(t, 0.6, float64(counts["b"])/picks, 0.03)
+	assert.InDelta(t, 0.2, float64(counts["c"])/picks, 0.03, "weight defaults to 1")
+}
+
+func TestServiceConfig(t *testing.T) {
+	endpoints := []Endpoint{{Addr: "a"}}
+	for _, tc := range []struct {
+		cfg      Config
+		expected string
+	}{
+		{Config{BaseURL: "a"}, ""},
+		{Config{Endpoints: endpoints}, `{"loadBalancingConfig":[{"round_robin":{}}]}`},
+		{Config{BaseURL: "a", Balancer: PickFirstBalancer}, `{"loadBalancingConfig":[{"pick_first":{}}]}`},
+		{Config{Endpoints: endpoints, Balancer: LeastRequestBalancer},
+			`{"loadBalancingConfig":[{"least_request_experimental":{"choiceCount":2}}]}`},
+		{Config{Endpoints: endpoints, Balancer: WeightedBalancer},
+			`{"loadBalancingConfig":[{"kyber_weighted_random":{}}]}`},
+	} {
+		serviceConfig := tc.cfg.serviceConfig()
+		assert.Equal(t, tc.expected, serviceConfig)
+		if serviceConfig == "" {
+			continue
+		}
+		assert.True(t, json.Valid([]byte(serviceConfig)), serviceConfig)
+		cfg := tc.cfg
+		client, err := New(testpb.NewTestServiceClient, WithConfig(&cfg), WithInsecure())
+		require.NoError(t, err, "grpc parses the service config of %s", serviceConfig)
+		_ = client.Close()
+	}
+}
+
+func TestConfigTarget(t *testing.T) {
+	assert.Equal(t, "dns:///svc:9080", (&Config{BaseURL: "dns:///svc:9080"}).target())
+	cfg := &Config{BaseURL: "x", Endpoints: []Endpoint{{Addr: "a:1"}, {Addr: "b:2"}}}
+	assert.Equal(t, "endpoints:///a:1,b:2", cfg.target())
+}
+
+func TestCanUpdateEndpoints(t *testing.T) {
+	cfg := &Config{Endpoints: []Endpoint{{Addr: "a"}}, Timeout: time.Second,
+		DialOptions:        []grpc.DialOption{grpc.WithUserAgent("test")},
+		StreamInterceptors: []grpc.StreamClientInterceptor{StreamMetricsInterceptor()}}
+	other := *cfg
+	other.Endpoints = []Endpoint{{Addr: "b", Weight: 2}}
+	other.DialOptions = []grpc.DialOption{grpc.WithUserAgent("test")}
+	other.StreamInterceptors = []grpc.StreamClientInterceptor{StreamMetricsInterceptor()}
+	assert.True(t, cfg.CanUpdateEndpoints(&other))
+
+	other.Timeout = 2 * time.Second
+	assert.False(t, cfg.CanUpdateEndpoints(&other))
+	assert.False(t, cfg.CanUpdateEndpoints(&Config{BaseURL: "a", Timeout: time.Second}))
+}
+
+func TestUpdateEndpoints(t *testing.T) {
+	serviceA, listenerA := serveTestService(t)
+	serviceB, listenerB := serveTestService(t)
+	listeners := map[string]*bufconn.Listener{"a": listenerA, "b": listenerB}
+	client, err := New(testpb.NewTestServiceClient, WithEndpoints(Endpoint{Addr: "a"}), WithInsecure(),
+		WithDialOption(grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return listeners[addr].DialContext(ctx)
+		})))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	ctx := context.Background()
+
+	_, err = client.C.EmptyCall(ctx, &testpb.Empty{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, serviceA.calls.Load())
+
+	conn := client.Conn
+	require.NoError(t, client.UpdateEndpoints([]Endpoint{{Addr: "b"}}))
+	assert.Equal(t, []Endpoint{{Addr: "b"}}, client.Endpoints())
+	assert.Eventually(t, func() bool {
+		_, err := client.C.EmptyCall(ctx, &testpb.Empty{})
+		return err == nil && serviceB.calls.Load() > 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Same(t, conn, client.Conn, "connection kept")
+
+	single, err := New(testpb.NewTestServiceClient, WithBaseURL("passthrough:///a"), WithInsecure())
+	require.NoError(t, err)
+	defer func() {
+		_ = single.Close()
+	}()
+	assert.Error(t, single.UpdateEndpoints([]Endpoint{{Addr: "b"}}))
+}
@@ -2,17 +2,31 @@ package grpcclient
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/validator"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/backoff"
-	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/KyberNetwork/service-framework/pkg/client/auth"
+	"github.com/KyberNetwork/service-framework/pkg/client/breaker"
 	"github.com/KyberNetwork/service-framework/pkg/common"
 	"github.com/KyberNetwork/service-framework/pkg/observe"
 	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
@@ -23,27 +37,49 @@ const (
 )
 
 type Config struct {
-	BaseURL           string
+	BaseURL           string     // target to dial, e.g. host:port or dns:///host:port to resolve all backend addresses
+	Endpoints         []Endpoint // static backend endpoints to balance between, overriding BaseURL
+	Balancer          Balancer   // load balancing policy between resolved backends
 	MinConnectTimeout time.Duration
 	ConnectBackoff    backoff.Config
 	IsBlockConnect    bool // deprecated: see grpc.WithBlock
 	GRPCCredentials   credentials.TransportCredentials
+	PerRPCCredentials credentials.PerRPCCredentials // e.g. auth.NewPerRPCCredentials, overriding Auth
+	Auth              *auth.Config                  // per-RPC credentials config, used if PerRPCCredentials is nil
 	Insecure          bool
 	Compression       Compression
 	Headers           map[string]string
 	ClientID          string
 	Timeout           time.Duration
+	StreamTimeout     time.Duration   // overall timeout of streaming calls
+	StreamIdleTimeout time.Duration   // timeout of streaming calls without any message sent or received
+	Retry             *RetryPolicy    // retry or hedging policy of unary calls, no retry if nil
+	CircuitBreaker    *breaker.Config // circuit breaker of unary calls, disabled if nil
+	PoolSize          int             // number of connections to spread calls over, default 1
+	Keepalive         keepalive.ClientParameters
+	MaxRecvMsgSize    int      // max size in bytes of received messages, default 4MB
+	MaxSendMsgSize    int      // max size in bytes of sent messages, default unlimited
+	NoPropagation     bool     // disables copying headers of incoming server calls into outgoing metadata
+	PropagateHeaders  []string // incoming headers to propagate besides common.PropagatedHeaders and server ones
 	DialOptions       []grpc.DialOption
+
+	StreamInterceptors []grpc.StreamClientInterceptor // additional stream interceptors, chained after default ones
 }
 
 // Client wraps the created grpc connection and client.
 type Client[T any] struct {
-	C    T                // inner grpc client
-	Cfg  *Config          // grpc connection dial config
-	Conn *grpc.ClientConn // grpc connection
+	C     T                  // inner grpc client
+	Cfg   *Config            // grpc connection dial config, whose Endpoints are updated by UpdateEndpoints
+	Conn  *grpc.ClientConn   // grpc connection, the first one of Conns
+	Conns []*grpc.ClientConn // all pooled grpc connections
+
+	resolvers   []*manual.Resolver // resolvers of Cfg.Endpoints per connection if set
+	endpointsMu sync.Mutex         // guards Cfg.Endpoints and updates of resolvers
+	inFlight    atomic.Int64       // number of in-flight calls, including streams not finished yet
 }
 
 // New creates a new instance of the Client using the provided client factory function and apply options.
+// If Config.PoolSize is greater than 1, the client is built over a pool of connections that calls are spread over.
 //
 // Parameters:
 // - clientFactory: A function that takes a grpc.ClientConnInterface and returns an instance of T.
@@ -58,22 +94,86 @@ func New[T any](clientFactory func(grpc.ClientConnInterface) T, applyOptions ...
 	for _, apply := range applyOptions {
 		apply(cfg)
 	}
-	if cfg.BaseURL == "" {
+	if cfg.BaseURL == "" && len(cfg.Endpoints) == 0 {
 		cfg.BaseURL = defaultGRPCBaseURL
 		cfg.Insecure = true
 	}
+	if cfg.Retry != nil {
+		if err := cfg.Retry.Validate(); err != nil {
+			return nil, err
+		}
+	}
 
-	dialOpts := cfg.dialOptions()
-	grpcConn, err := grpc.NewClient(cfg.BaseURL, dialOpts...)
-	if err != nil {
-		return nil, err
+	client := &Client[T]{Cfg: cfg}
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(client.inFlightInterceptor),
+		grpc.WithChainStreamInterceptor(client.streamInFlightInterceptor),
+	}, cfg.dialOptions()...)
+	for range max(cfg.PoolSize, 1) {
+		target, connDialOpts := cfg.BaseURL, slices.Clip(dialOpts)
+		if len(cfg.Endpoints) != 0 {
+			endpointsResolver := newEndpointsResolver(cfg.Endpoints)
+			client.resolvers = append(client.resolvers, endpointsResolver)
+			target, connDialOpts = endpointsTarget, append(connDialOpts, grpc.WithResolvers(endpointsResolver))
+		}
+		grpcConn, err := grpc.NewClient(target, connDialOpts...)
+		if err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+		client.Conns = append(client.Conns, grpcConn)
+	}
+
+	client.Conn = client.Conns[0]
+	if len(client.Conns) == 1 {
+		client.C = clientFactory(client.Conn)
+	} else {
+		client.C = clientFactory(&connPool{conns: client.Conns})
+	}
+	return client, nil
+}
+
+// UpdateEndpoints updates the backend endpoints of a client created with Config.Endpoints without recreating its
+// connections. Connections to unchanged endpoints are kept.
+func (c *Client[_]) UpdateEndpoints(endpoints []Endpoint) error {
+	if len(c.resolvers) == 0 {
+		return errors.New("grpcclient: client was not created with endpoints")
+	}
+	c.endpointsMu.Lock()
+	defer c.endpointsMu.Unlock()
+	c.Cfg.Endpoints = endpoints
+	for _, endpointsResolver := range c.resolvers {
+		endpointsResolver.UpdateState(endpointsState(endpoints))
+	}
+	return nil
+}
+
+// Endpoints returns the current backend endpoints of the client, safe to call concurrently with UpdateEndpoints.
+func (c *Client[_]) Endpoints() []Endpoint {
+	c.endpointsMu.Lock()
+	defer c.endpointsMu.Unlock()
+	return c.Cfg.Endpoints
+}
+
+// CanUpdateEndpoints checks whether a client created with this config can switch to the other config by only calling
+// Client.UpdateEndpoints, i.e. both configs have endpoints and no other differing config value. Options only settable
+// in code, i.e. credentials, dial options and interceptors, are not compared.
+func (c *Config) CanUpdateEndpoints(other *Config) bool {
+	if len(c.Endpoints) == 0 || len(other.Endpoints) == 0 {
+		return false
 	}
+	return reflect.DeepEqual(c.configValues(), other.configValues())
+}
 
-	return &Client[T]{
-		C:    clientFactory(grpcConn),
-		Cfg:  cfg,
-		Conn: grpcConn,
-	}, nil
+// configValues returns a copy of c without Endpoints and options only settable in code, which cannot be compared. Its
+// request headers are defaulted as when dialing, so that the config of a dialed Client compares equal to its source.
+func (c *Config) configValues() Config {
+	values := *c
+	values.requestHeaders()
+	values.Endpoints = nil
+	values.GRPCCredentials, values.PerRPCCredentials = nil, nil
+	values.DialOptions, values.StreamInterceptors = nil, nil
+	return values
 }
 
 // dialOptions returns the dial options from the Config struct.
@@ -91,9 +191,25 @@ func (c *Config) dialOptions() []grpc.DialOption {
 		dialOpts = append(dialOpts, grpc.WithTransportCredentials(creds))
 	}
 
+	if c.PerRPCCredentials == nil && c.Auth != nil {
+		c.PerRPCCredentials = c.Auth.NewPerRPCCredentials()
+	}
+	if c.PerRPCCredentials != nil {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(c.PerRPCCredentials))
+	}
+
 	if c.Compression != NoCompression {
 		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(string(c.Compression))))
 	}
+	if c.MaxRecvMsgSize != 0 {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(c.MaxRecvMsgSize)))
+	}
+	if c.MaxSendMsgSize != 0 {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(c.MaxSendMsgSize)))
+	}
+	if c.Keepalive != (keepalive.ClientParameters{}) {
+		dialOpts = append(dialOpts, grpc.WithKeepaliveParams(c.Keepalive))
+	}
 
 	connectParams := grpc.ConnectParams{
 		Backoff: backoff.Config{
@@ -121,6 +237,10 @@ func (c *Config) dialOptions() []grpc.DialOption {
 	}
 	dialOpts = append(dialOpts, grpc.WithConnectParams(connectParams))
 
+	if serviceConfig := c.serviceConfig(); serviceConfig != "" {
+		dialOpts = append(dialOpts, grpc.WithDefaultServiceConfig(serviceConfig))
+	}
+
 	requestHeaders := c.requestHeaders()
 	unaryInterceptors := []grpc.UnaryClientInterceptor{
 		validator.UnaryClientInterceptor(),
@@ -130,9 +250,36 @@ func (c *Config) dialOptions() []grpc.DialOption {
 	if c.Timeout != 0 {
 		unaryInterceptors = append(unaryInterceptors, TimeoutInterceptor(c.Timeout))
 	}
+	if !c.NoPropagation {
+		unaryInterceptors = append(unaryInterceptors, PropagationInterceptor(c.PropagateHeaders...))
+	}
+	if c.CircuitBreaker != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			breaker.UnaryClientInterceptor(breaker.NewGroup(c.target(), c.CircuitBreaker)))
+	}
+	if c.Retry != nil {
+		unaryInterceptors = append(unaryInterceptors, RetryInterceptor(c.Retry))
+	}
+	if creds, ok := c.PerRPCCredentials.(*auth.PerRPCCredentials); ok {
+		unaryInterceptors = append(unaryInterceptors, creds.UnaryClientInterceptor())
+	}
 
 	dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(unaryInterceptors...))
 
+	streamInterceptors := []grpc.StreamClientInterceptor{
+		StreamRequestHeadersInterceptor(requestHeaders),
+		StreamMetricsInterceptor(),
+	}
+	if !c.NoPropagation {
+		streamInterceptors = append(streamInterceptors, StreamPropagationInterceptor(c.PropagateHeaders...))
+	}
+	if c.StreamTimeout != 0 || c.StreamIdleTimeout != 0 {
+		streamInterceptors = append(streamInterceptors, StreamTimeoutInterceptor(c.StreamTimeout, c.StreamIdleTimeout))
+	}
+	streamInterceptors = append(streamInterceptors, c.StreamInterceptors...)
+
+	dialOpts = append(dialOpts, grpc.WithChainStreamInterceptor(streamInterceptors...))
+
 	observe.EnsureTracerProvider()
 	dialOpts = append(dialOpts, grpc.WithStatsHandler(otelgrpc.NewClientHandler()), grpc.WithDisableServiceConfig())
 
@@ -141,6 +288,7 @@ func (c *Config) dialOptions() []grpc.DialOption {
 
 // requestHeaders generates the request headers based on the provided configuration.
 func (c *Config) requestHeaders() map[string]string {
+	c.Headers = maps.Clone(c.Headers) // avoid mutating the map shared with the source config
 	if c.Headers == nil {
 		c.Headers = make(map[string]string)
 	}
@@ -151,8 +299,49 @@ func (c *Config) requestHeaders() map[string]string {
 	return c.Headers
 }
 
+// WaitForReady connects the client and waits until all its connections are ready or ctx is done.
+func (c *Client[_]) WaitForReady(ctx context.Context) error {
+	for _, conn := range c.Conns {
+		conn.Connect()
+		for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+			if !conn.WaitForStateChange(ctx, state) {
+				return fmt.Errorf("grpcclient: connection to %s is %s: %w", conn.Target(), state, ctx.Err())
+			}
+		}
+	}
+	return nil
+}
+
+// InFlight returns the number of in-flight calls of the client, including streams not finished yet.
+func (c *Client[_]) InFlight() int64 {
+	return c.inFlight.Load()
+}
+
+func (c *Client[_]) inFlightInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (c *Client[_]) streamInFlightInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	c.inFlight.Add(1)
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		c.inFlight.Add(-1)
+		return nil, err
+	}
+	context.AfterFunc(stream.Context(), func() { c.inFlight.Add(-1) }) // stream context ends with the stream
+	return stream, nil
+}
+
 func (c *Client[_]) Close() error {
-	return c.Conn.Close()
+	var errs []error
+	for _, conn := range c.Conns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
 }
 
 type TimeoutCallOption struct {
@@ -182,38 +371,61 @@ func getForcedTimeout(callOptions []grpc.CallOption) (time.Duration, bool) {
 }
 
 // RequestHeadersInterceptor intercepts gRPC unary client
-// invocations and adds custom headers to the outgoing request.
+// invocations and adds custom headers to the outgoing request. It also propagates the x-debug header of debug calls.
 func RequestHeadersInterceptor(header map[string]string) grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
 		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		md := metadata.New(header)
-		if existingMd, ok := metadata.FromOutgoingContext(ctx); ok {
-			for k, v := range existingMd {
-				md.Set(k, v...)
-			}
+		return invoker(outgoingCtxWithHeaders(ctx, header), method, req, reply, cc, opts...)
+	}
+}
+
+// outgoingCtxWithHeaders adds custom headers and the x-debug header of debug calls to the outgoing metadata of ctx.
+// Headers already set in the outgoing metadata take precedence.
+func outgoingCtxWithHeaders(ctx context.Context, header map[string]string) context.Context {
+	md := metadata.New(header)
+	if token, ok := common.DebugFromCtx(ctx); ok {
+		md.Set(common.HeaderXDebug, token)
+	}
+	if existingMd, ok := metadata.FromOutgoingContext(ctx); ok {
+		for k, v := range existingMd {
+			md.Set(k, v...)
 		}
-		ctx = metadata.NewOutgoingContext(ctx, md)
-		return invoker(ctx, method, req, reply, cc, opts...)
 	}
+	return metadata.NewOutgoingContext(ctx, md)
 }
 
-// MetricsInterceptor intercepts gRPC unary client invocations to record metrics.
+// MetricsInterceptor intercepts gRPC unary client invocations to record metrics: request count, duration and
+// request/response sizes by target, method and grpc code. For successful calls whose reply has a GetCode method, its
+// application code is recorded as well, as the app_code attribute.
 func MetricsInterceptor() grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
 		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		startTime := time.Now()
 		defer func() {
-			code := codes.OK
-			if reply, ok := reply.(interface{ GetCode() int32 }); ok {
-				code = codes.Code(reply.GetCode())
-			} else if err != nil {
-				code = codes.Unknown
+			keyValues := []string{kmetric.AttrTarget, cc.Target(), kmetric.AttrMethod, method,
+				kmetric.AttrCode, status.Code(err).String()}
+			if reply, ok := reply.(interface{ GetCode() int32 }); ok && err == nil {
+				keyValues = append(keyValues, kmetric.AttrAppCode, strconv.Itoa(int(reply.GetCode())))
+			}
+			kmetric.RecordOutgoingRequest(ctx, time.Since(startTime), keyValues...)
+			responseSize := int64(-1)
+			if err == nil {
+				responseSize = messageSize(reply)
 			}
-			kmetric.IncOutgoingRequest(ctx, kmetric.AttrMethod, method, kmetric.AttrCode, code.String())
+			kmetric.RecordOutgoingSizes(ctx, messageSize(req), responseSize, keyValues...)
 		}()
 		return invoker(ctx, method, req, reply, cc, opts...)
 	}
 }
 
+// messageSize returns the wire size of a proto message, or -1 if unknown.
+func messageSize(msg any) int64 {
+	if msg, ok := msg.(proto.Message); ok {
+		return int64(proto.Size(msg))
+	}
+	return -1
+}
+
 // TimeoutInterceptor intercepts unary client requests and adds a timeout to the context.
 func TimeoutInterceptor(t time.Duration) grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
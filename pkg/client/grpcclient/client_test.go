@@ -0,0 +1,130 @@
+package grpcclient
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric/kmetrictest"
+)
+
+func TestMetricsInterceptor(t *testing.T) {
+	const target = "passthrough:///metrics"
+	_, listener := serveTestService(t)
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}), grpc.WithUnaryInterceptor(MetricsInterceptor()))
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+	client := testpb.NewTestServiceClient(conn)
+	requests := func(method string, code codes.Code) func() int64 {
+		return kmetrictest.CounterDelta(t, kmetric.OutgoingRequest, attribute.String(kmetric.AttrTarget, target),
+			attribute.String(kmetric.AttrMethod, method), attribute.String(kmetric.AttrCode, code.String()))
+	}
+	ok := requests(testpb.TestService_EmptyCall_FullMethodName, codes.OK)
+	unimplemented := requests(testpb.TestService_UnaryCall_FullMethodName, codes.Unimplemented)
+	durations := kmetrictest.HistogramCountDelta(t, kmetric.OutgoingDuration,
+		attribute.String(kmetric.AttrTarget, target))
+	requestSizes := kmetrictest.HistogramCountDelta(t, kmetric.OutgoingRequestSize,
+		attribute.String(kmetric.AttrTarget, target))
+	responseSizes := kmetrictest.HistogramCountDelta(t, kmetric.OutgoingResponseSize,
+		attribute.String(kmetric.AttrTarget, target))
+
+	ctx := context.Background()
+	_, err = client.EmptyCall(ctx, &testpb.Empty{})
+	require.NoError(t, err)
+	_, err = client.UnaryCall(ctx, &testpb.SimpleRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	assert.EqualValues(t, 1, ok())
+	assert.EqualValues(t, 1, unimplemented())
+	assert.EqualValues(t, 2, durations())
+	assert.EqualValues(t, 2, requestSizes())
+	assert.EqualValues(t, 1, responseSizes(), "no response size of failed calls")
+
+	appCode := kmetrictest.CounterDelta(t, kmetric.OutgoingRequest, attribute.String(kmetric.AttrTarget, target),
+		attribute.String(kmetric.AttrCode, codes.OK.String()), attribute.String(kmetric.AttrAppCode, "5"))
+	err = MetricsInterceptor()(ctx, testpb.TestService_EmptyCall_FullMethodName, &testpb.Empty{},
+		&codeReply{code: 5}, conn, func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+			return nil
+		})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, appCode(), "application code is recorded along the grpc code")
+}
+
+type codeReply struct {
+	testpb.Empty
+	code int32
+}
+
+func (r *codeReply) GetCode() int32 {
+	return r.code
+}
+
+func TestKeepalive(t *testing.T) {
+	base := len((&Config{}).dialOptions())
+	for _, params := range []keepalive.ClientParameters{
+		{Time: time.Minute},
+		{Timeout: time.Second},
+		{PermitWithoutStream: true},
+	} {
+		assert.Len(t, (&Config{Keepalive: params}).dialOptions(), base+1, "%+v", params)
+	}
+}
+
+func TestConnPool(t *testing.T) {
+	service, listener := serveTestService(t)
+	var dials atomic.Int32
+	client, err := New(testpb.NewTestServiceClient, WithBaseURL("passthrough:///pool"), WithInsecure(),
+		WithPoolSize(3), WithDialOption(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			dials.Add(1)
+			return listener.DialContext(ctx)
+		})))
+	require.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	require.Len(t, client.Conns, 3)
+	assert.Same(t, client.Conns[0], client.Conn)
+
+	ctx := context.Background()
+	for range 6 {
+		_, err = client.C.EmptyCall(ctx, &testpb.Empty{})
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 6, service.calls.Load())
+	assert.EqualValues(t, 3, dials.Load(), "calls are spread over all connections")
+	for _, conn := range client.Conns {
+		assert.Equal(t, connectivity.Ready, conn.GetState())
+	}
+	require.NoError(t, client.WaitForReady(ctx))
+
+	stream, err := client.C.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{
+		ResponseParameters: []*testpb.ResponseParameters{{}},
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, client.InFlight())
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	assert.Eventually(t, func() bool {
+		return client.InFlight() == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -8,6 +8,9 @@ import (
 	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/KyberNetwork/service-framework/pkg/client/breaker"
 )
 
 type Compression string
@@ -58,6 +61,32 @@ func WithTimeout(timeout time.Duration) ApplyOption {
 	}
 }
 
+func WithRetryPolicy(policy *RetryPolicy) ApplyOption {
+	return func(c *Config) {
+		c.Retry = policy
+	}
+}
+
+func WithCircuitBreaker(cfg *breaker.Config) ApplyOption {
+	return func(c *Config) {
+		c.CircuitBreaker = cfg
+	}
+}
+
+func WithStreamTimeout(timeout, idleTimeout time.Duration) ApplyOption {
+	return func(c *Config) {
+		c.StreamTimeout = timeout
+		c.StreamIdleTimeout = idleTimeout
+	}
+}
+
+// WithStreamInterceptors adds stream interceptors to be chained after the default ones.
+func WithStreamInterceptors(interceptors ...grpc.StreamClientInterceptor) ApplyOption {
+	return func(c *Config) {
+		c.StreamInterceptors = append(c.StreamInterceptors, interceptors...)
+	}
+}
+
 func WithCompression(compression Compression) ApplyOption {
 	return func(c *Config) {
 		c.Compression = compression
@@ -84,6 +113,55 @@ func WithBaseURL(baseURL string) ApplyOption {
 	}
 }
 
+func WithEndpoints(endpoints ...Endpoint) ApplyOption {
+	return func(c *Config) {
+		c.Endpoints = endpoints
+	}
+}
+
+func WithBalancer(balancer Balancer) ApplyOption {
+	return func(c *Config) {
+		c.Balancer = balancer
+	}
+}
+
+func WithPoolSize(poolSize int) ApplyOption {
+	return func(c *Config) {
+		c.PoolSize = poolSize
+	}
+}
+
+func WithKeepalive(keepaliveParams keepalive.ClientParameters) ApplyOption {
+	return func(c *Config) {
+		c.Keepalive = keepaliveParams
+	}
+}
+
+func WithMaxMsgSize(maxRecvMsgSize, maxSendMsgSize int) ApplyOption {
+	return func(c *Config) {
+		c.MaxRecvMsgSize = maxRecvMsgSize
+		c.MaxSendMsgSize = maxSendMsgSize
+	}
+}
+
+func WithPropagateHeaders(headers ...string) ApplyOption {
+	return func(c *Config) {
+		c.PropagateHeaders = append(c.PropagateHeaders, headers...)
+	}
+}
+
+func WithoutPropagation() ApplyOption {
+	return func(c *Config) {
+		c.NoPropagation = true
+	}
+}
+
+func WithPerRPCCredentials(creds credentials.PerRPCCredentials) ApplyOption {
+	return func(c *Config) {
+		c.PerRPCCredentials = creds
+	}
+}
+
 func WithTLS(tlsCfg *tls.Config) ApplyOption {
 	return func(c *Config) {
 		c.GRPCCredentials = credentials.NewTLS(tlsCfg)
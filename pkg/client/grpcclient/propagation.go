@@ -0,0 +1,45 @@
+package grpcclient
+
+import (
+	"context"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/KyberNetwork/service-framework/pkg/common"
+)
+
+// PropagationInterceptor intercepts gRPC unary client invocations to copy common.PropagatedHeaders, the pass-through
+// headers of the server (see common.PassThruHeadersFromCtx) and extraHeaders from the incoming server call of ctx into
+// the outgoing metadata. Headers already set in the outgoing metadata take precedence.
+func PropagationInterceptor(extraHeaders ...string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingCtxWithPropagatedHeaders(ctx, extraHeaders), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamPropagationInterceptor is the streaming counterpart of PropagationInterceptor.
+func StreamPropagationInterceptor(extraHeaders ...string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingCtxWithPropagatedHeaders(ctx, extraHeaders), desc, cc, method, opts...)
+	}
+}
+
+func outgoingCtxWithPropagatedHeaders(ctx context.Context, extraHeaders []string) context.Context {
+	headers := common.HeadersToPropagate(ctx,
+		slices.Concat(common.PropagatedHeaders(), common.PassThruHeadersFromCtx(ctx), extraHeaders))
+	if len(headers) == 0 {
+		return ctx
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	for header, values := range headers {
+		if len(md.Get(header)) == 0 {
+			md.Set(header, values...)
+		}
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
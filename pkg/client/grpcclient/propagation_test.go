@@ -0,0 +1,38 @@
+package grpcclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/KyberNetwork/service-framework/pkg/common"
+)
+
+func TestPropagationInterceptor(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		common.HeaderXRequestId, "req-1",
+		common.HeaderXClientId, "caller",
+		"x-pass-thru", "pass",
+		"x-extra", "extra",
+		"x-other", "other",
+	))
+	ctx = common.CtxWithPassThruHeaders(ctx, []string{"x-pass-thru"})
+	ctx = metadata.AppendToOutgoingContext(ctx, common.HeaderXRequestId, "req-2")
+
+	var outgoing metadata.MD
+	err := PropagationInterceptor("x-extra")(ctx, "/test/Method", nil, nil, nil,
+		func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			outgoing, _ = metadata.FromOutgoingContext(ctx)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, metadata.Pairs(
+		common.HeaderXRequestId, "req-2",
+		"x-pass-thru", "pass",
+		"x-extra", "extra",
+	), outgoing, "existing outgoing headers take precedence")
+}
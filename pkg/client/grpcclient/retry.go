@@ -0,0 +1,330 @@
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	expbackoff "github.com/cenkalti/backoff/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/KyberNetwork/service-framework/pkg/common"
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+)
+
+const (
+	defaultHedgingDelay   = 100 * time.Millisecond
+	defaultHedgingRetries = 2
+)
+
+// RetryPolicy configures retrying or hedging of unary calls. Its backoff between retries is a common.BackoffCfg, with
+// MaxRetries capping the number of retries (unlimited within MaxElapsedTime if 0). Retries stop early if the next
+// backoff would exceed the call's deadline, which includes the timeout set by TimeoutInterceptor or WithForcedTimeout.
+type RetryPolicy struct {
+	common.BackoffCfg `mapstructure:",squash"`
+	NoRetry           bool     // disables retries, e.g. for a method of a service whose calls are otherwise retried
+	RetryableCodes    []string // retryable status codes such as UNAVAILABLE, default UNAVAILABLE
+	// Hedging sends another attempt after each HedgingDelay without waiting for the previous ones to fail, and
+	// returns the first non-retryable result. Up to MaxRetries (default 2) attempts are hedged. Only enable it for
+	// idempotent methods.
+	Hedging      bool
+	HedgingDelay time.Duration // delay between hedged attempts, default 100ms
+
+	// Methods overrides the policy per full method name (/package.Service/Method) or per service (/package.Service).
+	// Unset fields of an override default to the ones of this policy.
+	Methods map[string]*RetryPolicy
+}
+
+// Validate checks that the retryable codes of the policy and its overrides are valid status codes.
+func (p *RetryPolicy) Validate() error {
+	_, err := p.compileAll()
+	return err
+}
+
+// retryPolicy is the compiled form of RetryPolicy for a method.
+type retryPolicy struct {
+	backOff        *common.BackoffCfg
+	noRetry        bool
+	retryableCodes map[codes.Code]struct{}
+	hedging        bool
+	hedgingDelay   time.Duration
+}
+
+// compile merges p over parent and compiles the result, ignoring unknown retryable codes, which are returned as an
+// error.
+func (p *RetryPolicy) compile(parent *retryPolicy) (*retryPolicy, error) {
+	compiled := &retryPolicy{
+		backOff:      &common.BackoffCfg{},
+		hedgingDelay: defaultHedgingDelay,
+		retryableCodes: map[codes.Code]struct{}{
+			codes.Unavailable: {},
+		},
+	}
+	if parent != nil {
+		*compiled = *parent
+	}
+	compiled.backOff = p.BackoffCfg.Merge(compiled.backOff)
+	if p.NoRetry {
+		compiled.noRetry = true
+	}
+	var err error
+	if len(p.RetryableCodes) != 0 {
+		compiled.retryableCodes = make(map[codes.Code]struct{}, len(p.RetryableCodes))
+		var unknownCodes []string
+		for _, name := range p.RetryableCodes {
+			if code, ok := parseCode(name); ok {
+				compiled.retryableCodes[code] = struct{}{}
+			} else {
+				unknownCodes = append(unknownCodes, name)
+			}
+		}
+		if len(unknownCodes) != 0 {
+			err = fmt.Errorf("grpcclient: unknown retryable codes %q", unknownCodes)
+		}
+	}
+	if p.Hedging {
+		compiled.hedging = true
+	}
+	if p.HedgingDelay != 0 {
+		compiled.hedgingDelay = p.HedgingDelay
+	}
+	return compiled, err
+}
+
+// compileAll compiles the default, service and method policies of p, returning the policy of each method.
+func (p *RetryPolicy) compileAll() (func(method string) *retryPolicy, error) {
+	var errs []error
+	compile := func(override *RetryPolicy, parent *retryPolicy) *retryPolicy {
+		compiled, err := override.compile(parent)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return compiled
+	}
+	defaultPolicy := compile(p, nil)
+	servicePolicies := make(map[string]*retryPolicy)
+	methodPolicies := make(map[string]*retryPolicy)
+	for name, override := range p.Methods {
+		if override != nil && strings.Count(name, "/") < 2 {
+			servicePolicies[strings.TrimSuffix(name, "/")] = compile(override, defaultPolicy)
+		}
+	}
+	for name, override := range p.Methods {
+		if override == nil || strings.Count(name, "/") < 2 {
+			continue
+		}
+		parent := defaultPolicy
+		if servicePolicy, ok := servicePolicies[name[:strings.LastIndexByte(name, '/')]]; ok {
+			parent = servicePolicy
+		}
+		methodPolicies[name] = compile(override, parent)
+	}
+	return func(method string) *retryPolicy {
+		if policy, ok := methodPolicies[method]; ok {
+			return policy
+		}
+		if idx := strings.LastIndexByte(method, '/'); idx > 0 {
+			if policy, ok := servicePolicies[method[:idx]]; ok {
+				return policy
+			}
+		}
+		return defaultPolicy
+	}, errors.Join(errs...)
+}
+
+// parseCode parses a status code from its name in either upper snake case (UNAVAILABLE), camel case (Unavailable)
+// or its number.
+func parseCode(name string) (codes.Code, bool) {
+	if number, err := strconv.ParseUint(name, 10, 32); err == nil && number <= uint64(codes.Unauthenticated) {
+		return codes.Code(number), true
+	}
+	name = strings.ReplaceAll(name, "_", "")
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		if strings.EqualFold(name, code.String()) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+func (p *retryPolicy) retryable(err error) bool {
+	_, ok := p.retryableCodes[status.Code(err)]
+	return ok
+}
+
+// RetryInterceptor intercepts unary client requests to retry or hedge them per the given policy. It should be chained
+// after TimeoutInterceptor so that all attempts share the same deadline. Unknown retryable codes are ignored: check
+// them with RetryPolicy.Validate, as New does.
+func RetryInterceptor(policy *RetryPolicy) grpc.UnaryClientInterceptor {
+	policyFor, _ := policy.compileAll()
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		p := policyFor(method)
+		if p.noRetry {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if replyMsg, ok := reply.(proto.Message); ok && p.hedging {
+			return p.hedge(ctx, method, req, replyMsg, cc, invoker, opts...)
+		}
+		return p.retry(ctx, method, req, reply, cc, invoker, opts...)
+	}
+}
+
+// retry invokes the call until it succeeds, fails with a non-retryable code, runs out of retries, or the next backoff
+// would exceed the deadline.
+func (p *retryPolicy) retry(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	backOff := p.backOff.NewBackOff()
+	for attempt := 1; ; attempt++ {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil || !p.retryable(err) {
+			return err
+		}
+		wait := backOff.NextBackOff()
+		if wait == expbackoff.Stop {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return err
+		}
+		recordAttempt(ctx, cc, method, attempt+1, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// hedge invokes the call every hedgingDelay (or right after a retryable failure) until an attempt succeeds or fails
+// with a non-retryable code, or all attempts fail. Each attempt decodes into its own reply, header, trailer and peer,
+// and those of the attempt whose result is returned are copied to reply and to the caller's call options.
+func (p *retryPolicy) hedge(ctx context.Context, method string, req any, reply proto.Message, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	maxAttempts := defaultHedgingRetries + 1
+	if p.backOff.MaxRetries != 0 {
+		maxAttempts = int(p.backOff.MaxRetries) + 1
+	}
+
+	type result struct {
+		reply        proto.Message
+		err          error
+		copyCallOpts func()
+	}
+	results := make(chan result, maxAttempts)
+	launched := 0
+	launch := func(lastErr error) {
+		launched++
+		if launched > 1 {
+			recordAttempt(ctx, cc, method, launched, lastErr)
+		}
+		attemptReply := reply.ProtoReflect().New().Interface()
+		attemptOpts, copyCallOpts := attemptCallOpts(opts)
+		go func() {
+			err := invoker(ctx, method, req, attemptReply, cc, attemptOpts...)
+			results <- result{attemptReply, err, copyCallOpts}
+		}()
+	}
+
+	launch(nil)
+	timer := time.NewTimer(p.hedgingDelay)
+	defer timer.Stop()
+	var lastErr error
+	for finished := 0; ; {
+		select {
+		case res := <-results:
+			finished++
+			if res.err == nil {
+				proto.Reset(reply)
+				proto.Merge(reply, res.reply)
+				res.copyCallOpts()
+				return nil
+			}
+			if !p.retryable(res.err) {
+				res.copyCallOpts()
+				return res.err
+			}
+			lastErr = res.err
+			if finished < launched {
+				continue
+			}
+			if launched >= maxAttempts {
+				res.copyCallOpts()
+				return lastErr
+			}
+			launch(lastErr)
+			timer.Reset(p.hedgingDelay)
+		case <-timer.C:
+			if launched < maxAttempts {
+				launch(lastErr)
+				timer.Reset(p.hedgingDelay)
+			}
+		case <-ctx.Done():
+			if lastErr != nil {
+				return lastErr
+			}
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// attemptCallOpts returns opts with their header, trailer and peer call options replaced by ones writing to values of
+// a single hedged attempt, so that concurrent attempts do not race, and a func copying these values to the original
+// call options.
+func attemptCallOpts(opts []grpc.CallOption) ([]grpc.CallOption, func()) {
+	attemptOpts := make([]grpc.CallOption, len(opts))
+	var copies []func()
+	for i, opt := range opts {
+		switch opt := opt.(type) {
+		case grpc.HeaderCallOption:
+			header := new(metadata.MD)
+			attemptOpts[i] = grpc.Header(header)
+			copies = append(copies, func() { *opt.HeaderAddr = *header })
+		case grpc.TrailerCallOption:
+			trailer := new(metadata.MD)
+			attemptOpts[i] = grpc.Trailer(trailer)
+			copies = append(copies, func() { *opt.TrailerAddr = *trailer })
+		case grpc.PeerCallOption:
+			p := new(peer.Peer)
+			attemptOpts[i] = grpc.Peer(p)
+			copies = append(copies, func() { *opt.PeerAddr = *p })
+		default:
+			attemptOpts[i] = opt
+		}
+	}
+	return attemptOpts, func() {
+		for _, copyOpt := range copies {
+			copyOpt()
+		}
+	}
+}
+
+// recordAttempt records a retried or hedged attempt in metrics and as an event of the current span.
+func recordAttempt(ctx context.Context, cc *grpc.ClientConn, method string, attempt int, lastErr error) {
+	code := status.Code(lastErr)
+	kmetric.IncOutgoingRequestRetry(ctx, kmetric.AttrMethod, method, kmetric.AttrCode, code.String())
+	var target string
+	if cc != nil {
+		target = cc.Target()
+	}
+	trace.SpanFromContext(ctx).AddEvent("grpc.retry", trace.WithAttributes(
+		attribute.String("rpc.target", target),
+		attribute.String(kmetric.AttrMethod, method),
+		attribute.Int(kmetric.AttrAttempt, attempt),
+		attribute.String(kmetric.AttrCode, code.String()),
+	))
+}
@@ -0,0 +1,162 @@
+package grpcclient
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	expbackoff "github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/KyberNetwork/service-framework/pkg/common"
+)
+
+func TestParseCode(t *testing.T) {
+	for name, expected := range map[string]codes.Code{
+		"UNAVAILABLE":       codes.Unavailable,
+		"Unavailable":       codes.Unavailable,
+		"DEADLINE_EXCEEDED": codes.DeadlineExceeded,
+		"ResourceExhausted": codes.ResourceExhausted,
+		"14":                codes.Unavailable,
+	} {
+		code, ok := parseCode(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, expected, code, name)
+	}
+	for _, name := range []string{"NOT_A_CODE", "17"} {
+		_, ok := parseCode(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	assert.NoError(t, (&RetryPolicy{RetryableCodes: []string{"UNAVAILABLE", "Internal"}}).Validate())
+
+	policy := &RetryPolicy{Methods: map[string]*RetryPolicy{
+		"/svc.Service": {RetryableCodes: []string{"UNAVAILBLE"}},
+	}}
+	assert.ErrorContains(t, policy.Validate(), "UNAVAILBLE")
+	_, err := New(func(grpc.ClientConnInterface) any { return nil }, WithRetryPolicy(policy))
+	assert.ErrorContains(t, err, "UNAVAILBLE")
+}
+
+func failingInvoker(failures int32, code codes.Code, calls *atomic.Int32) grpc.UnaryInvoker {
+	return func(ctx context.Context, _ string, _, reply any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		if calls.Add(1) <= failures {
+			return status.Error(code, "failed")
+		}
+		reply.(*wrapperspb.StringValue).Value = "ok"
+		return nil
+	}
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	policy := &RetryPolicy{
+		BackoffCfg: common.BackoffCfg{
+			ExponentialBackOff: expbackoff.ExponentialBackOff{InitialInterval: time.Millisecond},
+			MaxRetries:         2,
+		},
+		Methods: map[string]*RetryPolicy{
+			"/svc.Service/NoRetry": {NoRetry: true},
+			"/svc.Other":           {RetryableCodes: []string{"INTERNAL"}},
+		},
+	}
+	interceptor := RetryInterceptor(policy)
+	ctx := context.Background()
+
+	t.Run("retries until success", func(t *testing.T) {
+		var calls atomic.Int32
+		reply := &wrapperspb.StringValue{}
+		err := interceptor(ctx, "/svc.Service/Get", nil, reply, nil, failingInvoker(2, codes.Unavailable, &calls))
+		assert.NoError(t, err)
+		assert.Equal(t, int32(3), calls.Load())
+		assert.Equal(t, "ok", reply.Value)
+	})
+
+	t.Run("stops after max attempts", func(t *testing.T) {
+		var calls atomic.Int32
+		err := interceptor(ctx, "/svc.Service/Get", nil, &wrapperspb.StringValue{}, nil,
+			failingInvoker(5, codes.Unavailable, &calls))
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("does not retry non-retryable codes", func(t *testing.T) {
+		var calls atomic.Int32
+		err := interceptor(ctx, "/svc.Service/Get", nil, &wrapperspb.StringValue{}, nil,
+			failingInvoker(5, codes.InvalidArgument, &calls))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("applies method overrides", func(t *testing.T) {
+		var calls atomic.Int32
+		_ = interceptor(ctx, "/svc.Service/NoRetry", nil, &wrapperspb.StringValue{}, nil,
+			failingInvoker(5, codes.Unavailable, &calls))
+		assert.Equal(t, int32(1), calls.Load())
+
+		calls.Store(0)
+		err := interceptor(ctx, "/svc.Other/Get", nil, &wrapperspb.StringValue{}, nil,
+			failingInvoker(1, codes.Internal, &calls))
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("stops before exceeding deadline", func(t *testing.T) {
+		var calls atomic.Int32
+		slowPolicy := &RetryPolicy{BackoffCfg: common.BackoffCfg{
+			ExponentialBackOff: expbackoff.ExponentialBackOff{InitialInterval: time.Second},
+			MaxRetries:         2,
+		}}
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		err := RetryInterceptor(slowPolicy)(ctx, "/svc.Service/Get", nil, &wrapperspb.StringValue{}, nil,
+			failingInvoker(5, codes.Unavailable, &calls))
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Equal(t, int32(1), calls.Load())
+	})
+}
+
+func TestRetryInterceptorHedging(t *testing.T) {
+	interceptor := RetryInterceptor(&RetryPolicy{
+		BackoffCfg:   common.BackoffCfg{MaxRetries: 2},
+		Hedging:      true,
+		HedgingDelay: 10 * time.Millisecond,
+	})
+
+	var calls atomic.Int32
+	firstDone := make(chan struct{})
+	reply := &wrapperspb.StringValue{}
+	var header metadata.MD
+	start := time.Now()
+	err := interceptor(context.Background(), "/svc.Service/Get", nil, reply, nil,
+		func(ctx context.Context, _ string, _, reply any, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+			attempt := calls.Add(1)
+			if attempt == 1 {
+				defer close(firstDone)
+				<-ctx.Done() // first attempt hangs until cancelled by the winning attempt
+			}
+			for _, opt := range opts {
+				if headerOpt, ok := opt.(grpc.HeaderCallOption); ok {
+					*headerOpt.HeaderAddr = metadata.Pairs("attempt", strconv.Itoa(int(attempt)))
+				}
+			}
+			if attempt == 1 {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			reply.(*wrapperspb.StringValue).Value = "hedged"
+			return nil
+		}, grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.Equal(t, "hedged", reply.Value)
+	assert.Less(t, time.Since(start), time.Second)
+	<-firstDone
+	assert.Equal(t, []string{"2"}, header.Get("attempt"), "header of the winning attempt")
+}
@@ -0,0 +1,140 @@
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+)
+
+// StreamRequestHeadersInterceptor intercepts gRPC streaming client
+// invocations and adds custom headers to the outgoing request. It also propagates the x-debug header of debug calls.
+func StreamRequestHeadersInterceptor(header map[string]string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingCtxWithHeaders(ctx, header), desc, cc, method, opts...)
+	}
+}
+
+// StreamMetricsInterceptor intercepts gRPC streaming client invocations to record request count and duration by
+// target, method and code once the stream finishes.
+func StreamMetricsInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		startTime := time.Now()
+		record := func(err error) {
+			kmetric.RecordOutgoingRequest(ctx, time.Since(startTime), kmetric.AttrTarget, cc.Target(),
+				kmetric.AttrMethod, method, kmetric.AttrCode, status.Code(err).String())
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			record(err)
+			return nil, err
+		}
+		return newFinishClientStream(ctx, stream, desc, nil, record), nil
+	}
+}
+
+// StreamTimeoutInterceptor intercepts streaming client requests and cancels the stream if it lasts longer than
+// t (overridable by WithForcedTimeout) or if no message is sent or received for idleTimeout. Non-positive durations
+// disable the corresponding timeout. Note that a stream cancelled for being idle ends with codes.Canceled.
+func StreamTimeoutInterceptor(t, idleTimeout time.Duration) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		timeout := t
+		if v, ok := getForcedTimeout(opts); ok {
+			timeout = v
+		}
+		if timeout <= 0 && idleTimeout <= 0 {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		var cancel context.CancelFunc
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		} else {
+			ctx, cancel = context.WithCancel(ctx)
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		var idleTimer *time.Timer
+		if idleTimeout > 0 {
+			idleTimer = time.AfterFunc(idleTimeout, cancel)
+		}
+		return newFinishClientStream(ctx, stream, desc, func() {
+			if idleTimer != nil {
+				idleTimer.Reset(idleTimeout)
+			}
+		}, func(error) {
+			if idleTimer != nil {
+				idleTimer.Stop()
+			}
+			cancel()
+		}), nil
+	}
+}
+
+// finishClientStream wraps grpc.ClientStream to be notified of each sent/received message and of the stream finishing,
+// which is when RecvMsg returns an error (io.EOF for a successful stream), when RecvMsg receives the only response of a
+// stream without server streaming, or when ctx is done, e.g. cancelled by a caller that stops reading early.
+type finishClientStream struct {
+	grpc.ClientStream
+	desc       *grpc.StreamDesc
+	onActivity func()
+	onFinish   func(err error)
+	finishOnce sync.Once
+	stopCtx    func() bool
+}
+
+func newFinishClientStream(ctx context.Context, stream grpc.ClientStream, desc *grpc.StreamDesc, onActivity func(),
+	onFinish func(err error)) *finishClientStream {
+	s := &finishClientStream{ClientStream: stream, desc: desc, onActivity: onActivity, onFinish: onFinish}
+	s.stopCtx = context.AfterFunc(ctx, func() {
+		s.finish(status.FromContextError(ctx.Err()).Err())
+	})
+	return s
+}
+
+func (s *finishClientStream) finish(err error) {
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	s.finishOnce.Do(func() {
+		if s.onFinish != nil {
+			s.onFinish(err)
+		}
+	})
+}
+
+func (s *finishClientStream) activity() {
+	if s.onActivity != nil {
+		s.onActivity()
+	}
+}
+
+func (s *finishClientStream) SendMsg(m any) error {
+	s.activity()
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *finishClientStream) RecvMsg(m any) error {
+	s.activity()
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil && s.desc.ServerStreams {
+		s.activity()
+		return nil
+	}
+	s.stopCtx()
+	s.finish(err)
+	return err
+}
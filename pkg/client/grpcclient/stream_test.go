@@ -0,0 +1,190 @@
+package grpcclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric/kmetrictest"
+)
+
+type testService struct {
+	testpb.UnimplementedTestServiceServer
+	calls atomic.Int32 // number of EmptyCall calls
+}
+
+func (s *testService) EmptyCall(context.Context, *testpb.Empty) (*testpb.Empty, error) {
+	s.calls.Add(1)
+	return &testpb.Empty{}, nil
+}
+
+// StreamingOutputCall sends a response per response parameter after its interval.
+func (*testService) StreamingOutputCall(req *testpb.StreamingOutputCallRequest,
+	stream testpb.TestService_StreamingOutputCallServer) error {
+	for _, param := range req.ResponseParameters {
+		select {
+		case <-time.After(time.Duration(param.IntervalUs) * time.Microsecond):
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamingInputCall responds with the total payload size of the received requests.
+func (*testService) StreamingInputCall(stream testpb.TestService_StreamingInputCallServer) error {
+	var size int32
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&testpb.StreamingInputCallResponse{AggregatedPayloadSize: size})
+		} else if err != nil {
+			return err
+		}
+		size += int32(len(req.GetPayload().GetBody()))
+	}
+}
+
+// serveTestService serves a testService over bufconn until the test finishes.
+func serveTestService(t *testing.T) (*testService, *bufconn.Listener) {
+	service, listener := &testService{}, bufconn.Listen(1<<20)
+	server := grpc.NewServer()
+	testpb.RegisterTestServiceServer(server, service)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return service, listener
+}
+
+// newTestServiceClient serves testService over bufconn and returns a client to it with the given stream interceptors.
+func newTestServiceClient(t *testing.T, target string,
+	interceptors ...grpc.StreamClientInterceptor) testpb.TestServiceClient {
+	kmetrictest.EnsureMeterProvider()
+	_, listener := serveTestService(t)
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}), grpc.WithChainStreamInterceptor(interceptors...))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return testpb.NewTestServiceClient(conn)
+}
+
+// streamRequests returns a function counting the requests recorded by StreamMetricsInterceptor since it was created.
+func streamRequests(t *testing.T, target, method, code string) func() int64 {
+	return kmetrictest.CounterDelta(t, kmetric.OutgoingRequest, attribute.String(kmetric.AttrTarget, target),
+		attribute.String(kmetric.AttrMethod, method), attribute.String(kmetric.AttrCode, code))
+}
+
+// ctxCapturer captures the stream context passed down by the previous interceptors.
+func ctxCapturer(captured *context.Context) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		*captured = ctx
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func TestStreamInterceptors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("server streaming", func(t *testing.T) {
+		const target = "passthrough:///server-streaming"
+		requests := streamRequests(t, target, testpb.TestService_StreamingOutputCall_FullMethodName, "OK")
+		var streamCtx context.Context
+		client := newTestServiceClient(t, target, StreamMetricsInterceptor(),
+			StreamTimeoutInterceptor(time.Minute, time.Minute), ctxCapturer(&streamCtx))
+		stream, err := client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{
+			ResponseParameters: []*testpb.ResponseParameters{{}, {}},
+		})
+		require.NoError(t, err)
+		for range 2 {
+			_, err = stream.Recv()
+			require.NoError(t, err)
+		}
+		assert.NoError(t, streamCtx.Err())
+		assert.Zero(t, requests())
+
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, context.Canceled, streamCtx.Err())
+		assert.EqualValues(t, 1, requests())
+	})
+
+	t.Run("client streaming", func(t *testing.T) {
+		const target = "passthrough:///client-streaming"
+		requests := streamRequests(t, target, testpb.TestService_StreamingInputCall_FullMethodName, "OK")
+		var streamCtx context.Context
+		client := newTestServiceClient(t, target, StreamMetricsInterceptor(),
+			StreamTimeoutInterceptor(time.Minute, time.Minute), ctxCapturer(&streamCtx))
+		stream, err := client.StreamingInputCall(ctx)
+		require.NoError(t, err)
+		for _, body := range []string{"ab", "cde"} {
+			require.NoError(t, stream.Send(&testpb.StreamingInputCallRequest{Payload: &testpb.Payload{Body: []byte(body)}}))
+		}
+		resp, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.EqualValues(t, 5, resp.AggregatedPayloadSize)
+		assert.Equal(t, context.Canceled, streamCtx.Err(), "timers and context released")
+		assert.EqualValues(t, 1, requests())
+	})
+
+	t.Run("stop reading early", func(t *testing.T) {
+		const target = "passthrough:///stop-reading-early"
+		requests := streamRequests(t, target, testpb.TestService_StreamingOutputCall_FullMethodName, "Canceled")
+		client := newTestServiceClient(t, target, StreamMetricsInterceptor())
+		ctx, cancel := context.WithCancel(ctx)
+		stream, err := client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{
+			ResponseParameters: []*testpb.ResponseParameters{{}, {IntervalUs: int32(time.Minute / time.Microsecond)}},
+		})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.NoError(t, err)
+		cancel()
+		assert.Eventually(t, func() bool {
+			return requests() == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		const target = "passthrough:///idle-timeout"
+		requests := streamRequests(t, target, testpb.TestService_StreamingOutputCall_FullMethodName, "Canceled")
+		client := newTestServiceClient(t, target, StreamMetricsInterceptor(),
+			StreamTimeoutInterceptor(time.Minute, 50*time.Millisecond))
+		stream, err := client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{
+			ResponseParameters: []*testpb.ResponseParameters{
+				{IntervalUs: int32(20 * time.Millisecond / time.Microsecond)},
+				{IntervalUs: int32(20 * time.Millisecond / time.Microsecond)},
+				{IntervalUs: int32(time.Minute / time.Microsecond)},
+			},
+		})
+		require.NoError(t, err)
+		for range 2 {
+			_, err = stream.Recv()
+			require.NoError(t, err, "activity resets the idle timer")
+		}
+		_, err = stream.Recv()
+		assert.Equal(t, codes.Canceled, status.Code(err))
+		assert.EqualValues(t, 1, requests())
+	})
+}
@@ -1,35 +1,145 @@
 package client
 
 import (
+	"context"
+	"net/url"
+	"sync/atomic"
+	"time"
+
 	"github.com/KyberNetwork/kutils"
 	"github.com/KyberNetwork/kyber-trace-go/pkg/tracer"
 	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
+	"github.com/KyberNetwork/service-framework/pkg/client/auth"
+	"github.com/KyberNetwork/service-framework/pkg/client/breaker"
+	"github.com/KyberNetwork/service-framework/pkg/client/cassette"
 	"github.com/KyberNetwork/service-framework/pkg/common"
 )
 
+const HttpCloseDelay = time.Minute
+
 // HttpCfg is hotcfg for a resty http client. On update, it
 // creates a new resty client with the new config
-// as well as instruments the client for metrics and tracing.
+// as well as instruments the client for metrics, tracing and optionally access logs.
+// The previous client is kept if the new config is invalid, or closes its idle connections once drained per Reload.
+// As hosts may be third-party, headers of incoming server calls are only copied into requests if listed in
+// PropagateHeaders, such as common.PropagatedHeaders() for internal services.
 type HttpCfg struct {
-	kutils.HttpCfg `mapstructure:",squash"`
-	C              *resty.Client
+	kutils.HttpCfg   `mapstructure:",squash"`
+	CircuitBreaker   *breaker.Config      // circuit breakers per host, disabled if nil
+	Retry            *BackoffCfg          // retries idempotent requests on errors, 429 and 5xx; replaces RetryCount
+	Limit            *HttpLimitCfg        // rate and concurrency limits per host, disabled if nil
+	AccessLog        *HttpAccessLogCfg    // logs requests with redacted credentials, disabled if nil
+	Marshaler        HttpMarshalerOptions // protojson options of Do, matching the ones of the called server
+	Cassette         *cassette.Config     // records or replays requests for tests, disabled if nil
+	Auth             *auth.Config         // credentials to set the Authorization header of requests with
+	PropagateHeaders []string             // incoming headers to copy into requests, see below
+	Reload           ReloadCfg
+	C                *resty.Client
+
+	inFlight *atomic.Int64 // in-flight requests of C
+}
+
+func (*HttpCfg) OnUpdate(old, new *HttpCfg) {
+	ctx := context.Background()
+	var oldC *resty.Client
+	var oldLimit *HttpLimitCfg
+	if old != nil {
+		oldC, oldLimit = old.C, old.Limit
+	}
+	err := new.validate()
+	recordReload(ctx, new.name(), err, old.name())
+	if err != nil && oldC != nil {
+		new.C, new.inFlight = oldC, old.inFlight
+		new.Limit.keep(oldLimit)
+		return
+	}
+
+	new.Limit.onUpdate(oldLimit)
+	new.newClient()
+	if oldC != nil {
+		var oldInFlight func() int64
+		if old.inFlight != nil {
+			oldInFlight = old.inFlight.Load
+		}
+		drain(ctx, old.name(), new.Reload.drainTimeout(HttpCloseDelay), oldInFlight, func() error {
+			oldC.GetClient().CloseIdleConnections()
+			return nil
+		})
+	}
+}
+
+// validate checks the config before replacing the previous client.
+func (c *HttpCfg) validate() error {
+	if c.BaseUrl == "" {
+		return nil
+	}
+	baseUrl, err := url.Parse(c.BaseUrl)
+	if err != nil {
+		return errors.Wrapf(err.(*url.Error).Err, "HttpCfg.validate %s", c.name())
+	}
+	if baseUrl.Scheme == "" || baseUrl.Host == "" {
+		return errors.Errorf("HttpCfg.validate %s: base url must be absolute", c.name())
+	}
+	return nil
 }
 
-func (*HttpCfg) OnUpdate(_, new *HttpCfg) {
-	new.C = new.NewRestyClient().OnBeforeRequest(func(_ *resty.Client, r *resty.Request) error {
+func (c *HttpCfg) name() string {
+	if c == nil {
+		return ""
+	}
+	return "HttpCfg " + urlHost(c.BaseUrl)
+}
+
+// newClient creates the resty client of c.
+func (c *HttpCfg) newClient() {
+	c.C = c.NewRestyClient().OnBeforeRequest(func(restyClient *resty.Client, r *resty.Request) error {
+		setRestyRoute(restyClient, r)
+		for header, values := range common.HeadersToPropagate(r.Context(), c.PropagateHeaders) {
+			if len(r.Header.Values(header)) == 0 {
+				for _, value := range values {
+					r.Header.Add(header, value)
+				}
+			}
+		}
 		if len(r.Header.Values(common.HeaderXRequestId)) == 0 {
 			if traceID, ok := common.TraceIdFromCtx(r.Context()); ok {
 				r.Header.Set(common.HeaderXRequestId, traceID.String())
 			}
 		}
+		if token, ok := common.DebugFromCtx(r.Context()); ok && len(r.Header.Values(common.HeaderXDebug)) == 0 {
+			r.Header.Set(common.HeaderXDebug, token)
+		}
 		return nil
 	})
-	if len(new.C.Header.Values(common.HeaderXClientId)) == 0 {
-		new.C.Header.Set(common.HeaderXClientId, common.GetServiceClientId())
+	if len(c.C.Header.Values(common.HeaderXClientId)) == 0 {
+		c.C.Header.Set(common.HeaderXClientId, common.GetServiceClientId())
+	}
+	if c.Cassette != nil {
+		c.C.SetTransport(cassette.NewTransport(c.C.GetClient().Transport, c.Cassette))
+	}
+	if provider := c.Auth.Provider(); provider != nil {
+		c.C.SetTransport(auth.NewTransport(c.C.GetClient().Transport, provider))
 	}
 	if tracer.Provider() != nil {
-		new.C.SetTransport(otelhttp.NewTransport(new.C.GetClient().Transport))
+		c.C.SetTransport(otelhttp.NewTransport(c.C.GetClient().Transport))
+	}
+	c.C.SetTransport(newMetricsTransport(c.C.GetClient().Transport))
+	if c.AccessLog != nil {
+		c.C.SetTransport(newAccessLogTransport(c.C.GetClient().Transport, c.AccessLog))
+	}
+	if c.CircuitBreaker != nil {
+		c.C.SetTransport(breaker.NewTransport(c.C.GetClient().Transport, c.CircuitBreaker))
+	}
+	if c.Limit != nil {
+		c.C.SetTransport(newLimitTransport(c.C.GetClient().Transport, c.Limit.limiter))
+	}
+	if c.Retry != nil {
+		c.C.SetRetryCount(0)
+		c.C.SetTransport(newRetryTransport(c.C.GetClient().Transport, c.Retry))
 	}
+	c.inFlight = &atomic.Int64{}
+	c.C.SetTransport(&inFlightTransport{base: c.C.GetClient().Transport, inFlight: c.inFlight})
 }
@@ -0,0 +1,385 @@
+package client
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultLimitRedisPrefix  = "http_limit:"
+	limitRedisErrLogInterval = time.Minute
+	limitRedisRetryInterval  = 5 * time.Second // time to use local rate limits after a redis error before retrying redis
+)
+
+// HttpLimitCfg limits outgoing http requests per host with a token bucket and a cap of concurrent requests. Requests
+// wait for their turn up to their context deadline, failing with a ResourceExhausted status error if the wait would
+// exceed it or once it passes. Limiter states are kept across config updates, and shared by the previous client until
+// it is closed.
+type HttpLimitCfg struct {
+	Rate          float64 // max requests per second per host, unlimited if 0
+	Burst         int     // max requests in a burst per host, default ceil(Rate)
+	MaxConcurrent int     // max concurrent requests per host, unlimited if 0
+
+	// Redis shares rate limits across all replicas if set, falling back to local limits for a while on redis errors.
+	Redis       *RedisCfg
+	RedisPrefix string // prefix of redis keys, default http_limit:
+
+	// Hosts overrides the config per host (with or without port). Unset fields of an override default to the ones
+	// of this config.
+	Hosts map[string]*HttpLimitCfg
+
+	limiter *httpLimiter
+}
+
+// merge returns c with unset fields defaulting to those of parent.
+func (c *HttpLimitCfg) merge(parent *HttpLimitCfg) *HttpLimitCfg {
+	merged := HttpLimitCfg{Rate: parent.Rate, Burst: parent.Burst, MaxConcurrent: parent.MaxConcurrent}
+	if c.Rate != 0 {
+		merged.Rate = c.Rate
+	}
+	if c.Burst != 0 {
+		merged.Burst = c.Burst
+	}
+	if c.MaxConcurrent != 0 {
+		merged.MaxConcurrent = c.MaxConcurrent
+	}
+	if merged.Burst <= 0 {
+		merged.Burst = max(int(math.Ceil(merged.Rate)), 1)
+	}
+	return &merged
+}
+
+// limit returns the rate limit of c.
+func (c *HttpLimitCfg) limit() rate.Limit {
+	if c.Rate <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(c.Rate)
+}
+
+// onUpdate updates the redis client of c and takes over the limiter of old. It must only be called once the client
+// using the limiter is reloaded, as it replaces the redis client of old.
+func (c *HttpLimitCfg) onUpdate(old *HttpLimitCfg) {
+	var oldRedis *RedisCfg
+	if old != nil {
+		oldRedis = old.Redis
+	}
+	if c == nil || c.Redis == nil {
+		oldRedis.close() // redis is no longer used
+		if c == nil {
+			return
+		}
+	} else {
+		c.Redis.OnUpdate(oldRedis, c.Redis)
+	}
+	if old != nil && old.limiter != nil {
+		c.limiter = old.limiter
+	} else {
+		c.limiter = &httpLimiter{hosts: make(map[string]*hostLimiter)}
+	}
+	c.limiter.update(c)
+}
+
+// keep takes over the limiter and redis client of old, kept by the previous client if the reload of its config failed.
+func (c *HttpLimitCfg) keep(old *HttpLimitCfg) {
+	if c != nil && old != nil {
+		c.limiter = old.limiter
+		c.Redis.keep(old.Redis)
+	}
+}
+
+// httpLimiter holds the limiters of each host.
+type httpLimiter struct {
+	mu          sync.Mutex
+	cfg         *HttpLimitCfg
+	redis       redis.UniversalClient
+	redisPrefix string
+	hosts       map[string]*hostLimiter
+
+	lastRedisErrLog atomic.Int64
+	redisDownUntil  atomic.Int64 // unix nanos until which redis is skipped after an error
+}
+
+// update applies cfg to the limiters of all hosts.
+func (l *httpLimiter) update(cfg *HttpLimitCfg) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	oldRedis := l.redis
+	l.cfg, l.redis, l.redisPrefix = cfg, nil, cfg.RedisPrefix
+	if cfg.Redis != nil {
+		l.redis = cfg.Redis.C
+	}
+	if l.redis != oldRedis {
+		l.redisDownUntil.Store(0)
+	}
+	if l.redisPrefix == "" {
+		l.redisPrefix = defaultLimitRedisPrefix
+	}
+	for host, limiter := range l.hosts {
+		limiter.update(l.hostCfg(host))
+	}
+}
+
+// hostCfg returns the config of host, overridden by the config of either host or its hostname.
+func (l *httpLimiter) hostCfg(host string) *HttpLimitCfg {
+	if override, ok := l.cfg.Hosts[host]; ok && override != nil {
+		return override.merge(l.cfg)
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		if override, ok := l.cfg.Hosts[hostname]; ok && override != nil {
+			return override.merge(l.cfg)
+		}
+	}
+	return l.cfg.merge(l.cfg)
+}
+
+// get returns the limiter of host along with the redis client to share its rate limit with.
+func (l *httpLimiter) get(host string) (*hostLimiter, redis.UniversalClient, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limiter, ok := l.hosts[host]
+	if !ok {
+		cfg := l.hostCfg(host)
+		limiter = &hostLimiter{host: host, concurrency: &concurrencyLimiter{}}
+		limiter.update(cfg)
+		l.hosts[host] = limiter
+	}
+	return limiter, l.redis, l.redisPrefix
+}
+
+// hostLimiter limits the requests to a host.
+type hostLimiter struct {
+	host        string
+	cfg         atomic.Pointer[HttpLimitCfg]
+	rate        atomic.Pointer[rate.Limiter]
+	concurrency *concurrencyLimiter
+}
+
+func (l *hostLimiter) update(cfg *HttpLimitCfg) {
+	l.cfg.Store(cfg)
+	// an unlimited limiter has no state worth keeping, so it is replaced by one with a full burst
+	if limiter := l.rate.Load(); limiter != nil && limiter.Limit() != rate.Inf {
+		limiter.SetLimit(cfg.limit())
+		limiter.SetBurst(cfg.Burst)
+	} else {
+		l.rate.Store(rate.NewLimiter(cfg.limit(), cfg.Burst))
+	}
+	l.concurrency.setMax(cfg.MaxConcurrent)
+}
+
+// rateDelay returns the minimum wait for the local rate limit, to fail fast without waiting for a concurrency slot if
+// the deadline is already too short.
+func (l *hostLimiter) rateDelay() time.Duration {
+	limiter := l.rate.Load()
+	if limiter.Limit() == rate.Inf {
+		return 0
+	}
+	if tokens := limiter.Tokens(); tokens < 1 {
+		return time.Duration((1 - tokens) / float64(limiter.Limit()) * float64(time.Second))
+	}
+	return 0
+}
+
+// concurrencyLimiter caps concurrent calls, with a max that can change while calls are waiting.
+type concurrencyLimiter struct {
+	mu      sync.Mutex
+	max     int // unlimited if 0
+	active  int
+	waiters []chan struct{}
+}
+
+// acquire waits for a slot until ctx is done, failing immediately without a free slot if ctx is already done.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.max <= 0 || l.active < l.max {
+		l.active++
+		l.mu.Unlock()
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	waiter := make(chan struct{})
+	l.waiters = append(l.waiters, waiter)
+	l.mu.Unlock()
+
+	select {
+	case <-waiter:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, w := range l.waiters {
+			if w == waiter {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// the slot was granted meanwhile
+		l.active--
+		l.grant()
+		return ctx.Err()
+	}
+}
+
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.grant()
+}
+
+func (l *concurrencyLimiter) setMax(maxConcurrent int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.max = maxConcurrent
+	l.grant()
+}
+
+// grant hands free slots to waiters in order. It must be called with mu held.
+func (l *concurrencyLimiter) grant() {
+	for len(l.waiters) != 0 && (l.max <= 0 || l.active < l.max) {
+		l.active++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
+
+// limitTransport is an http.RoundTripper middleware limiting requests per host per HttpLimitCfg. A concurrency slot
+// is held until the response body is closed.
+type limitTransport struct {
+	base    http.RoundTripper
+	limiter *httpLimiter
+}
+
+func newLimitTransport(base http.RoundTripper, limiter *httpLimiter) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &limitTransport{base: base, limiter: limiter}
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	limiter, redisClient, redisPrefix := t.limiter.get(req.URL.Host)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < limiter.rateDelay() {
+		return nil, status.Errorf(codes.ResourceExhausted, "rate limit of %s: wait would exceed context deadline",
+			limiter.host)
+	}
+	if err := limiter.concurrency.acquire(ctx); err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "concurrency limit of %s: %v", limiter.host, err)
+	}
+	if err := t.waitRate(ctx, limiter, redisClient, redisPrefix); err != nil {
+		limiter.concurrency.release()
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		limiter.concurrency.release()
+		return nil, err
+	}
+	resp.Body = &inFlightBody{ReadCloser: resp.Body, done: limiter.concurrency.release}
+	return resp, nil
+}
+
+// waitRate waits for the rate limit of a host, shared via redis if configured. After a redis error, local rate limits
+// are used for limitRedisRetryInterval instead of paying a failing redis round trip on every request.
+func (t *limitTransport) waitRate(ctx context.Context, limiter *hostLimiter, redisClient redis.UniversalClient,
+	redisPrefix string) error {
+	cfg := limiter.cfg.Load()
+	if cfg.Rate <= 0 {
+		return nil
+	}
+	if redisClient != nil && time.Now().UnixNano() >= t.limiter.redisDownUntil.Load() {
+		for {
+			wait, err := redisAllow(ctx, redisClient, redisPrefix+limiter.host, cfg.Rate, cfg.Burst)
+			if err != nil {
+				if ctx.Err() == nil {
+					t.limiter.redisDownUntil.Store(time.Now().Add(limitRedisRetryInterval).UnixNano())
+					t.logRedisErr(ctx, limiter.host, err)
+				}
+				break
+			}
+			if wait <= 0 {
+				return nil
+			}
+			if err = sleepUntilDeadline(ctx, wait); err != nil {
+				return status.Errorf(codes.ResourceExhausted, "rate limit of %s: %v", limiter.host, err)
+			}
+		}
+	}
+	if err := limiter.rate.Load().Wait(ctx); err != nil {
+		return status.Errorf(codes.ResourceExhausted, "rate limit of %s: %v", limiter.host, err)
+	}
+	return nil
+}
+
+// logRedisErr logs redis errors at most once per limitRedisErrLogInterval.
+func (t *limitTransport) logRedisErr(ctx context.Context, host string, err error) {
+	now := time.Now().UnixNano()
+	last := t.limiter.lastRedisErrLog.Load()
+	if now-last < int64(limitRedisErrLogInterval) || !t.limiter.lastRedisErrLog.CompareAndSwap(last, now) {
+		return
+	}
+	klog.Warnf(ctx, "limitTransport.waitRate|falling back to local rate limit|host=%s|err=%v", host, err)
+}
+
+// sleepUntilDeadline sleeps for d, failing immediately if it would exceed the deadline of ctx.
+func sleepUntilDeadline(ctx context.Context, d time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return errors.Errorf("wait of %s would exceed context deadline", d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// redisGcraScript implements the generic cell rate algorithm: it stores the theoretical arrival time of the next
+// request, and allows a request if that time is within the burst tolerance from now. It returns the time to wait in
+// seconds before retrying, or 0 if the request is allowed.
+var redisGcraScript = redis.NewScript(`
+local emission = 1 / tonumber(ARGV[1])
+local tolerance = emission * tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local tat = math.max(tonumber(redis.call("GET", KEYS[1]) or now), now)
+local wait = tat + emission - tolerance - now
+if wait > 0 then
+	return tostring(wait)
+end
+redis.call("SET", KEYS[1], tostring(tat + emission), "PX", math.ceil((tat + emission - now) * 1000))
+return "0"
+`)
+
+// redisAllow checks the rate limit of key in redis, returning the time to wait before retrying if not allowed.
+func redisAllow(ctx context.Context, client redis.UniversalClient, key string, ratePerSecond float64,
+	burst int) (time.Duration, error) {
+	result, err := redisGcraScript.Run(ctx, client, []string{key}, ratePerSecond, burst).Text()
+	if err != nil {
+		return 0, errors.Wrapf(err, "redisAllow %s", key)
+	}
+	wait, err := strconv.ParseFloat(result, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "redisAllow %s", key)
+	}
+	return time.Duration(wait * float64(time.Second)), nil
+}
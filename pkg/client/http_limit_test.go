@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHttpCfgLimit(t *testing.T) {
+	var active, maxActive atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := active.Add(1)
+		defer active.Add(-1)
+		for prev := maxActive.Load(); current > prev && !maxActive.CompareAndSwap(prev, current); {
+			prev = maxActive.Load()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	cfg := &HttpCfg{Limit: &HttpLimitCfg{MaxConcurrent: 1}}
+	cfg.BaseUrl = server.URL
+	cfg.OnUpdate(nil, cfg)
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cfg.C.R().Get("/")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, maxActive.Load(), "concurrency is capped")
+
+	newCfg := &HttpCfg{Limit: &HttpLimitCfg{Rate: 1, Hosts: map[string]*HttpLimitCfg{"127.0.0.1": {Burst: 2}}}}
+	newCfg.BaseUrl = server.URL
+	newCfg.OnUpdate(cfg, newCfg)
+	assert.Same(t, cfg.Limit.limiter, newCfg.Limit.limiter, "limiter is kept on update")
+	for range 2 {
+		_, err := newCfg.C.R().Get("/")
+		require.NoError(t, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := newCfg.C.R().SetContext(ctx).Get("/")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "wait would exceed deadline")
+
+	invalidCfg := &HttpCfg{Limit: &HttpLimitCfg{Rate: 100}}
+	invalidCfg.BaseUrl = "/relative"
+	invalidCfg.OnUpdate(newCfg, invalidCfg)
+	reloadErrs.Delete(invalidCfg.name())
+	assert.Same(t, newCfg.C, invalidCfg.C)
+	assert.Same(t, newCfg.Limit, newCfg.Limit.limiter.cfg, "limits of the kept client are not updated")
+}
+
+func TestHttpCfgConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := &HttpCfg{Limit: &HttpLimitCfg{MaxConcurrent: 1}}
+	cfg.BaseUrl = server.URL
+	cfg.OnUpdate(nil, cfg)
+	resp, err := cfg.C.R().SetDoNotParseResponse(true).Get("/")
+	require.NoError(t, err)
+	defer resp.RawBody().Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = cfg.C.R().SetContext(ctx).Get("/")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "concurrency wait past deadline")
+	_, err = cfg.C.R().SetContext(ctx).Get("/")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "expired deadline fails fast")
+}
+
+func TestHttpCfgRedisLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	redisServer := miniredis.RunT(t)
+
+	newCfg := func() *HttpCfg {
+		cfg := &HttpCfg{Limit: &HttpLimitCfg{Rate: 0.5, Burst: 1, Redis: &RedisCfg{
+			UniversalOptions: redis.UniversalOptions{Addrs: []string{redisServer.Addr()}}}}}
+		cfg.BaseUrl = server.URL
+		cfg.OnUpdate(nil, cfg)
+		return cfg
+	}
+	replica1, replica2 := newCfg(), newCfg()
+
+	_, err := replica1.C.R().Get("/")
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = replica2.C.R().SetContext(ctx).Get("/")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "quota is shared across replicas")
+
+	redisServer.Close()
+	_, err = replica2.C.R().Get("/")
+	assert.NoError(t, err, "falls back to local limit")
+
+	require.NoError(t, redisServer.Restart())
+	commandCount := redisServer.CommandCount()
+	replica2.Limit.Rate, replica2.Limit.Burst = 1000, 1000
+	replica2.Limit.limiter.update(replica2.Limit)
+	_, err = replica2.C.R().Get("/")
+	assert.NoError(t, err)
+	assert.Equal(t, commandCount, redisServer.CommandCount(), "redis is not retried right after an error")
+
+	invalidCfg := &HttpCfg{Limit: &HttpLimitCfg{Rate: 1, Redis: &RedisCfg{
+		UniversalOptions: redis.UniversalOptions{Addrs: []string{redisServer.Addr()}}}}}
+	invalidCfg.BaseUrl = "/relative"
+	invalidCfg.OnUpdate(replica1, invalidCfg)
+	reloadErrs.Delete(invalidCfg.name())
+	assert.Same(t, replica1.Limit.Redis.C, invalidCfg.Limit.Redis.C, "redis client is kept if the reload fails")
+	assert.NoError(t, replica1.Limit.Redis.C.Ping(context.Background()).Err(), "kept redis client is not closed")
+
+	replica1.Limit.Redis.Reload.DrainTimeout = time.Millisecond
+	noRedisCfg := &HttpCfg{Limit: &HttpLimitCfg{Rate: 1}}
+	noRedisCfg.BaseUrl = server.URL
+	noRedisCfg.OnUpdate(replica1, noRedisCfg)
+	assert.Eventually(t, func() bool {
+		return replica1.Limit.Redis.C.Ping(context.Background()).Err() != nil
+	}, time.Second, 10*time.Millisecond, "redis client is closed once removed")
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+)
+
+const redacted = "REDACTED"
+
+var (
+	defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+	defaultRedactParams  = []string{"access_token", "api_key", "apikey", "key", "password", "secret", "signature",
+		"token"}
+)
+
+// HttpAccessLogCfg configures access logs of outgoing http requests, logged per attempt at info level, or warn level
+// for 5xx and transport errors. Auth headers and query params are redacted.
+type HttpAccessLogCfg struct {
+	Headers       bool     // whether to log request headers
+	RedactHeaders []string // headers to redact in addition to Authorization, Proxy-Authorization, Cookie and X-Api-Key
+	RedactParams  []string // query params to redact in addition to common credential ones such as token and api_key
+	RedactQuery   bool     // whether to redact all query params
+}
+
+// accessLogTransport is an http.RoundTripper middleware logging outgoing requests per HttpAccessLogCfg.
+type accessLogTransport struct {
+	base          http.RoundTripper
+	headers       bool
+	redactHeaders map[string]struct{}
+	redactParams  map[string]struct{}
+	redactQuery   bool
+}
+
+func newAccessLogTransport(base http.RoundTripper, cfg *HttpAccessLogCfg) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &accessLogTransport{
+		base:          base,
+		headers:       cfg.Headers,
+		redactHeaders: make(map[string]struct{}),
+		redactParams:  make(map[string]struct{}),
+		redactQuery:   cfg.RedactQuery,
+	}
+	for _, header := range append(defaultRedactHeaders, cfg.RedactHeaders...) {
+		t.redactHeaders[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	for _, param := range append(defaultRedactParams, cfg.RedactParams...) {
+		t.redactParams[strings.ToLower(param)] = struct{}{}
+	}
+	return t
+}
+
+func (t *accessLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	startTime := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	ctx := req.Context()
+	fields := klog.Fields{
+		"method": req.Method,
+		"url":    t.redactUrl(req.URL),
+		"dur":    time.Since(startTime),
+	}
+	if route, ok := HttpRouteFromCtx(ctx); ok {
+		fields["route"] = route
+	}
+	if t.headers {
+		fields["headers"] = t.redactHeader(req.Header)
+	}
+	if req.ContentLength >= 0 {
+		fields["req_size"] = req.ContentLength
+	}
+	log := klog.WithFields(ctx, fields)
+	if err != nil {
+		log.Warnf("http request failed|err=%v", err)
+		return resp, err
+	}
+	log = log.WithFields(klog.Fields{"status": resp.StatusCode, "resp_size": resp.ContentLength})
+	if resp.StatusCode >= http.StatusInternalServerError {
+		log.Warn("http response received")
+	} else {
+		log.Info("http response received")
+	}
+	return resp, err
+}
+
+// redactUrl returns u with redacted user password and query params.
+func (t *accessLogTransport) redactUrl(u *url.URL) string {
+	redactedUrl := *u
+	if _, hasPassword := u.User.Password(); hasPassword {
+		redactedUrl.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	if u.RawQuery == "" {
+		return redactedUrl.String()
+	}
+	query := u.Query()
+	for param, values := range query {
+		if _, ok := t.redactParams[strings.ToLower(param)]; ok || t.redactQuery {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	redactedUrl.RawQuery = query.Encode()
+	return redactedUrl.String()
+}
+
+// redactHeader returns a copy of header with redacted values.
+func (t *accessLogTransport) redactHeader(header http.Header) http.Header {
+	redactedHeader := header.Clone()
+	for key, values := range redactedHeader {
+		if _, ok := t.redactHeaders[http.CanonicalHeaderKey(key)]; ok {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	return redactedHeader
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+)
+
+const (
+	// codeOk is the code attribute of successful outgoing calls other than http requests, the same as grpc codes.OK.
+	codeOk = "OK"
+	// codeTransportError is the code attribute of outgoing http requests failing without a response.
+	codeTransportError = "error"
+)
+
+type ctxKeyHttpRoute struct{}
+
+// CtxWithHttpRoute sets the route template (such as /users/{id}) of outgoing http requests made with ctx, to label
+// their metrics and access logs without the cardinality of actual paths. Resty requests using path params default to
+// their url template. With resty, use r.SetContext(client.CtxWithHttpRoute(ctx, route)).
+func CtxWithHttpRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, ctxKeyHttpRoute{}, route)
+}
+
+// HttpRouteFromCtx returns the route template set by CtxWithHttpRoute.
+func HttpRouteFromCtx(ctx context.Context) (string, bool) {
+	route, ok := ctx.Value(ctxKeyHttpRoute{}).(string)
+	return route, ok
+}
+
+// setRestyRoute sets the url template of r as its route if it uses path params and has no route yet.
+func setRestyRoute(c *resty.Client, r *resty.Request) {
+	if len(r.PathParams)+len(r.RawPathParams)+len(c.PathParams)+len(c.RawPathParams) == 0 {
+		return
+	} else if _, ok := HttpRouteFromCtx(r.Context()); ok {
+		return
+	}
+	route := r.URL
+	if _, afterScheme, ok := strings.Cut(route, "://"); ok {
+		route = afterScheme[strings.IndexByte(afterScheme+"/", '/'):]
+	}
+	route, _, _ = strings.Cut(route, "?")
+	r.SetContext(CtxWithHttpRoute(r.Context(), route))
+}
+
+// statusClass returns the class (such as 2xx) of an http status code.
+func statusClass(statusCode int) string {
+	return strconv.Itoa(statusCode/100) + "xx"
+}
+
+// metricsTransport is an http.RoundTripper middleware recording outgoing request count, duration and sizes by
+// target host, route template, http method, status code and status class via kmetric, the same way as
+// grpcclient.MetricsInterceptor.
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func newMetricsTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &metricsTransport{base: base}
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	startTime := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	code, class, responseSize := codeTransportError, codeTransportError, int64(-1)
+	if err == nil {
+		code, class, responseSize = strconv.Itoa(resp.StatusCode), statusClass(resp.StatusCode), resp.ContentLength
+	}
+	ctx := req.Context()
+	route, _ := HttpRouteFromCtx(ctx)
+	keyValues := []string{kmetric.AttrTarget, req.URL.Host, kmetric.AttrRoute, route, kmetric.AttrMethod, req.Method,
+		kmetric.AttrCode, code, kmetric.AttrStatusClass, class}
+	kmetric.RecordOutgoingRequest(ctx, time.Since(startTime), keyValues...)
+	kmetric.RecordOutgoingSizes(ctx, req.ContentLength, responseSize, keyValues...)
+	return resp, err
+}
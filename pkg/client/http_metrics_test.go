@@ -0,0 +1,50 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric/kmetrictest"
+)
+
+func TestMetricsTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("missing"))
+	}))
+	host := strings.TrimPrefix(server.URL, "http://")
+	attrs := []attribute.KeyValue{attribute.String(kmetric.AttrTarget, host),
+		attribute.String(kmetric.AttrRoute, "/users/{id}"), attribute.String(kmetric.AttrMethod, http.MethodPost)}
+	notFound := kmetrictest.CounterDelta(t, kmetric.OutgoingRequest, append(attrs,
+		attribute.String(kmetric.AttrCode, "404"), attribute.String(kmetric.AttrStatusClass, "4xx"))...)
+	failed := kmetrictest.CounterDelta(t, kmetric.OutgoingRequest, append(attrs,
+		attribute.String(kmetric.AttrCode, codeTransportError))...)
+	durations := kmetrictest.HistogramCountDelta(t, kmetric.OutgoingDuration, attrs...)
+	requestSizes := kmetrictest.HistogramCountDelta(t, kmetric.OutgoingRequestSize, attrs...)
+	responseSizes := kmetrictest.HistogramCountDelta(t, kmetric.OutgoingResponseSize, attrs...)
+
+	cfg := &HttpCfg{}
+	cfg.BaseUrl = server.URL
+	cfg.OnUpdate(nil, cfg)
+	resp, err := cfg.C.R().SetPathParam("id", "1").SetBody("body").Post("/users/{id}")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+	server.Close()
+	_, err = cfg.C.R().SetPathParam("id", "1").SetBody("body").Post("/users/{id}")
+	var urlErr *url.Error
+	require.ErrorAs(t, err, &urlErr)
+
+	assert.EqualValues(t, 1, notFound())
+	assert.EqualValues(t, 1, failed())
+	assert.EqualValues(t, 2, durations())
+	assert.EqualValues(t, 2, requestSizes())
+	assert.EqualValues(t, 1, responseSizes(), "no response size without response")
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/KyberNetwork/service-framework/pkg/common"
+)
+
+const contentTypeJSON = "application/json"
+
+// HttpStatusError is the error of a non-2xx http response, carrying the grpc status decoded from a grpc-gateway error
+// body, or derived from the http status code otherwise. It is compatible with status.FromError and status.Code.
+type HttpStatusError struct {
+	StatusCode int    // http status code
+	Body       []byte // raw response body
+	status     *status.Status
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("http %d: rpc error: code = %s desc = %s", e.StatusCode, e.status.Code(), e.status.Message())
+}
+
+// GRPCStatus returns the grpc status of the error.
+func (e *HttpStatusError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+// RequestId returns the request_id detail injected into error statuses by framework servers, if any.
+func (e *HttpStatusError) RequestId() string {
+	return RequestIdFromStatus(e.status)
+}
+
+// RequestIdFromStatus returns the request_id detail injected into error statuses by framework servers, if any.
+func RequestIdFromStatus(st *status.Status) string {
+	for _, detail := range st.Details() {
+		if detailStruct, ok := detail.(*structpb.Struct); ok {
+			if requestId := detailStruct.GetFields()[common.FieldNameRequestId].GetStringValue(); requestId != "" {
+				return requestId
+			}
+		}
+	}
+	return ""
+}
+
+// Do sends req as protojson to the path of c with the given http method per c.Marshaler, the same way as
+// grpc-gateway of framework servers, and decodes the response into a new Resp. The request body is omitted for GET
+// and HEAD requests or if req is nil; such fields should be set as path or query params by the caller via opts.
+// An empty 2xx response body decodes into an empty Resp. Non-2xx responses return an *HttpStatusError.
+func Do[Req, Resp proto.Message](ctx context.Context, c *HttpCfg, method, path string, req Req,
+	opts ...func(*resty.Request)) (Resp, error) {
+	var resp Resp
+	var body []byte
+	if req.ProtoReflect().IsValid() && method != http.MethodGet && method != http.MethodHead {
+		var err error
+		if body, err = c.Marshaler.marshalOptions().Marshal(req); err != nil {
+			return resp, errors.Wrapf(err, "client.Do|marshal %s %s", method, path)
+		}
+	}
+	respBody, err := c.do(ctx, method, path, body, opts)
+	if err != nil {
+		return resp, err
+	}
+	resp = resp.ProtoReflect().Type().New().Interface().(Resp)
+	if len(respBody) == 0 {
+		return resp, nil
+	}
+	if err = c.Marshaler.unmarshalOptions().Unmarshal(respBody, resp); err != nil {
+		return resp, errors.Wrapf(err, "client.Do|unmarshal %s %s", method, path)
+	}
+	return resp, nil
+}
+
+// DoJSON sends req as json to the path of c with the given http method, and decodes the json response into a new
+// Resp. The request body is omitted if req is nil. Non-2xx responses return an *HttpStatusError.
+func DoJSON[Req, Resp any](ctx context.Context, c *HttpCfg, method, path string, req *Req,
+	opts ...func(*resty.Request)) (*Resp, error) {
+	var body []byte
+	if req != nil {
+		var err error
+		if body, err = c.C.JSONMarshal(req); err != nil {
+			return nil, errors.Wrapf(err, "client.DoJSON|marshal %s %s", method, path)
+		}
+	}
+	respBody, err := c.do(ctx, method, path, body, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(Resp)
+	if len(respBody) == 0 {
+		return resp, nil
+	}
+	if err = c.C.JSONUnmarshal(respBody, resp); err != nil {
+		return nil, errors.Wrapf(err, "client.DoJSON|unmarshal %s %s", method, path)
+	}
+	return resp, nil
+}
+
+// do sends a json request and returns the body of a 2xx response, or an *HttpStatusError.
+func (c *HttpCfg) do(ctx context.Context, method, path string, body []byte, opts []func(*resty.Request)) ([]byte,
+	error) {
+	r := c.C.R().SetContext(ctx).SetHeader("Accept", contentTypeJSON)
+	if body != nil {
+		r.SetHeader("Content-Type", contentTypeJSON).SetBody(body)
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	resp, err := r.Execute(method, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "client.do|%s %s", method, path)
+	}
+	if !resp.IsSuccess() {
+		return nil, newHttpStatusError(resp.StatusCode(), resp.Body())
+	}
+	return resp.Body(), nil
+}
+
+// newHttpStatusError decodes a grpc-gateway error body into an *HttpStatusError, falling back to a status derived from
+// the http status code if the body is not a status.
+func newHttpStatusError(statusCode int, body []byte) *HttpStatusError {
+	statusProto := &spb.Status{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, statusProto); err != nil ||
+		statusProto.Code == int32(codes.OK) {
+		statusProto = &spb.Status{Code: int32(codeFromHttpStatus(statusCode)), Message: string(body)}
+		if len(body) == 0 {
+			statusProto.Message = http.StatusText(statusCode)
+		}
+	}
+	return &HttpStatusError{StatusCode: statusCode, Body: body, status: status.FromProto(statusProto)}
+}
+
+// codeFromHttpStatus maps an http status code to a grpc code, inverting runtime.HTTPStatusFromCode of grpc-gateway.
+func codeFromHttpStatus(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499: // client closed request
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return codes.Unavailable
+	case http.StatusInternalServerError:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
+
+// HttpMarshalerOptions configures protojson of Do the same way as grpcserver.WithHTTPMarshalerOptions of the server.
+type HttpMarshalerOptions common.HttpMarshalerOptions
+
+func (o HttpMarshalerOptions) marshalOptions() protojson.MarshalOptions {
+	return protojson.MarshalOptions{
+		AllowPartial:    o.AllowPartialReq,
+		UseProtoNames:   o.UseProtoNames,
+		UseEnumNumbers:  o.UseEnumNumbers,
+		EmitUnpopulated: o.EmitUnpopulated,
+	}
+}
+
+func (o HttpMarshalerOptions) unmarshalOptions() protojson.UnmarshalOptions {
+	return protojson.UnmarshalOptions{
+		AllowPartial:   o.AllowPartialResp,
+		DiscardUnknown: !o.DisallowUnknown,
+	}
+}
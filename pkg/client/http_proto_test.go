@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		switch r.URL.Path {
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			_, _ = w.Write(body)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/missing":
+			st, _ := status.New(codes.NotFound, "not found").WithDetails(&structpb.Struct{
+				Fields: map[string]*structpb.Value{"request_id": structpb.NewStringValue("req-1")}})
+			body, _ := protojson.Marshal(st.Proto())
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write(body)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	cfg := &HttpCfg{}
+	cfg.BaseUrl = server.URL
+	cfg.OnUpdate(nil, cfg)
+	ctx := context.Background()
+
+	resp, err := Do[*wrapperspb.StringValue, *wrapperspb.StringValue](ctx, cfg, http.MethodPost, "/echo",
+		wrapperspb.String("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.GetValue())
+
+	resp, err = Do[*wrapperspb.StringValue, *wrapperspb.StringValue](ctx, cfg, http.MethodDelete, "/empty", nil)
+	require.NoError(t, err, "empty body is not unmarshalled")
+	assert.NotNil(t, resp)
+
+	type msg struct{ Value string }
+	jsonResp, err := DoJSON[msg, msg](ctx, cfg, http.MethodPost, "/echo", &msg{Value: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", jsonResp.Value)
+
+	_, err = Do[*wrapperspb.StringValue, *wrapperspb.StringValue](ctx, cfg, http.MethodGet, "/missing", nil)
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "not found", st.Message())
+	assert.Equal(t, "req-1", RequestIdFromStatus(st))
+	var httpErr *HttpStatusError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+
+	_, err = DoJSON[msg, msg](ctx, cfg, http.MethodGet, "/unavailable", nil)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+)
+
+const (
+	headerRetryAfter     = "Retry-After"
+	headerIdempotencyKey = "Idempotency-Key"
+)
+
+type ctxKeyRetryable struct{}
+
+// CtxWithRetryable marks outgoing http requests made with ctx as retryable even if their method is not idempotent.
+// With resty, use r.SetContext(client.CtxWithRetryable(ctx)).
+func CtxWithRetryable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyRetryable{}, struct{}{})
+}
+
+// isRetryableRequest checks whether req may be sent again: its method is idempotent, it has an idempotency key or
+// its context was marked by CtxWithRetryable, and its body, if any, can be replayed.
+func isRetryableRequest(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if req.Header.Get(headerIdempotencyKey) != "" || req.Header.Get("X-"+headerIdempotencyKey) != "" {
+		return true
+	}
+	return req.Context().Value(ctxKeyRetryable{}) != nil
+}
+
+// isRetryableResponse checks whether an attempt failed with a connection error, 429 or 5xx. Errors with a status,
+// such as the ones of open circuit breakers, and errors due to the request's context are not retried.
+func isRetryableResponse(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false
+		}
+		_, hasStatus := status.FromError(err)
+		return !hasStatus
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError &&
+		resp.StatusCode != http.StatusNotImplemented && resp.StatusCode != http.StatusHTTPVersionNotSupported
+}
+
+// retryAfter parses the Retry-After header of resp in either delay seconds or http date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get(headerRetryAfter)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryTransport is an http.RoundTripper middleware retrying requests that failed with a connection error, 429 or
+// 5xx per a BackoffCfg, waiting per Retry-After instead if the server set it, up to MaxInterval. Only idempotent
+// requests are retried (see isRetryableRequest). Retries stop early if the next wait would exceed MaxElapsedTime or
+// the request's deadline.
+type retryTransport struct {
+	base http.RoundTripper
+	cfg  *BackoffCfg
+}
+
+func newRetryTransport(base http.RoundTripper, cfg *BackoffCfg) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{base: base, cfg: cfg}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isRetryableRequest(req) {
+		return t.base.RoundTrip(req)
+	}
+	ctx := req.Context()
+	cfg := t.cfg.WithDefaults()
+	backOff, startTime := cfg.NewBackOff(), time.Now()
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if !isRetryableResponse(req, resp, err) {
+			return resp, err
+		}
+		wait, ok := retryAfter(resp, time.Now())
+		if nextBackOff := backOff.NextBackOff(); nextBackOff == backoff.Stop {
+			return resp, err
+		} else if !ok {
+			wait = nextBackOff
+		} else if wait = min(wait, cfg.MaxInterval); cfg.MaxElapsedTime != 0 &&
+			time.Since(startTime)+wait > cfg.MaxElapsedTime {
+			return resp, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return resp, err
+		}
+		retryReq, cloneErr := cloneRequest(req)
+		if cloneErr != nil {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			_ = resp.Body.Close()
+		}
+		recordHttpAttempt(ctx, req, attempt+1, resp, err, wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		req = retryReq
+	}
+}
+
+// cloneRequest clones req with a fresh body for another attempt.
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
+
+// recordHttpAttempt records a retried attempt in metrics and as an event of the current span.
+func recordHttpAttempt(ctx context.Context, req *http.Request, attempt int, lastResp *http.Response, lastErr error,
+	wait time.Duration) {
+	code := codeTransportError
+	if lastErr == nil {
+		code = strconv.Itoa(lastResp.StatusCode)
+	}
+	route, _ := HttpRouteFromCtx(ctx)
+	kmetric.IncOutgoingRequestRetry(ctx, kmetric.AttrTarget, req.URL.Host, kmetric.AttrRoute, route,
+		kmetric.AttrMethod, req.Method, kmetric.AttrCode, code)
+	trace.SpanFromContext(ctx).AddEvent("http.retry", trace.WithAttributes(
+		attribute.String("server.address", req.URL.Host),
+		attribute.String(kmetric.AttrMethod, req.Method),
+		attribute.Int(kmetric.AttrAttempt, attempt),
+		attribute.String(kmetric.AttrCode, code),
+		attribute.Int64("wait_ms", wait.Milliseconds()),
+	))
+}
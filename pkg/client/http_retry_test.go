@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHttpCfgRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/bad":
+			w.WriteHeader(http.StatusBadRequest)
+		case calls.Add(1)%3 != 0:
+			w.Header().Set(headerRetryAfter, "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &HttpCfg{Retry: &BackoffCfg{
+		ExponentialBackOff: backoff.ExponentialBackOff{InitialInterval: time.Millisecond},
+		MaxRetries:         3,
+	}}
+	cfg.BaseUrl = server.URL
+	cfg.OnUpdate(nil, cfg)
+
+	calls.Store(0)
+	resp, err := cfg.C.R().Get("/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.EqualValues(t, 3, calls.Load(), "retried until success")
+
+	calls.Store(0)
+	resp, err = cfg.C.R().SetBody("body").Post("/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	assert.EqualValues(t, 1, calls.Load(), "post is not retried")
+
+	calls.Store(0)
+	resp, err = cfg.C.R().SetContext(CtxWithRetryable(context.Background())).SetBody("body").Post("/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "body", resp.String(), "body is replayed")
+	assert.EqualValues(t, 3, calls.Load(), "opted-in post is retried")
+
+	calls.Store(0)
+	resp, err = cfg.C.R().Get("/bad")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+}
+
+func TestHttpCfgRetryAfterLimits(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set(headerRetryAfter, "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	newCfg := func(maxElapsedTime time.Duration) *HttpCfg {
+		cfg := &HttpCfg{Retry: &BackoffCfg{
+			ExponentialBackOff: backoff.ExponentialBackOff{InitialInterval: time.Millisecond,
+				MaxInterval: 10 * time.Millisecond, MaxElapsedTime: maxElapsedTime},
+			MaxRetries: 2,
+		}}
+		cfg.BaseUrl = server.URL
+		cfg.OnUpdate(nil, cfg)
+		return cfg
+	}
+
+	calls.Store(0)
+	startTime := time.Now()
+	resp, err := newCfg(time.Minute).C.R().Get("/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode())
+	assert.EqualValues(t, 3, calls.Load())
+	assert.Less(t, time.Since(startTime), time.Second, "retry-after is clamped to max interval")
+
+	calls.Store(0)
+	resp, err = newCfg(5 * time.Millisecond).C.R().Get("/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode())
+	assert.EqualValues(t, 1, calls.Load(), "not retried past max elapsed time")
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+	for value, expected := range map[string]time.Duration{
+		"2": 2 * time.Second,
+		now.Add(time.Minute).Format(http.TimeFormat):  time.Minute,
+		now.Add(-time.Minute).Format(http.TimeFormat): 0,
+	} {
+		wait, ok := retryAfter(&http.Response{Header: http.Header{headerRetryAfter: {value}}}, now)
+		assert.True(t, ok, value)
+		assert.InDelta(t, expected, wait, float64(time.Second), value)
+	}
+	_, ok := retryAfter(&http.Response{Header: http.Header{headerRetryAfter: {"soon"}}}, now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/KyberNetwork/service-framework/pkg/common"
+)
+
+func TestHttpPropagation(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		common.HeaderXForwardedFor, "1.1.1.1",
+		common.HeaderBaggage, "k=v",
+		"x-custom", "custom",
+	))
+	newCfg := func(propagateHeaders ...string) (*HttpCfg, *http.Header) {
+		var header http.Header
+		cfg := &HttpCfg{PropagateHeaders: propagateHeaders}
+		cfg.BaseUrl = "http://example.com"
+		cfg.HttpClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			header = req.Header
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		})}
+		cfg.OnUpdate(nil, cfg)
+		return cfg, &header
+	}
+
+	cfg, header := newCfg()
+	_, err := cfg.C.R().SetContext(ctx).Get("/")
+	require.NoError(t, err)
+	assert.Empty(t, header.Values(common.HeaderXForwardedFor), "nothing is propagated by default")
+	assert.Empty(t, header.Values(common.HeaderBaggage))
+	assert.Empty(t, header.Values("x-custom"))
+
+	cfg, header = newCfg("x-custom", common.HeaderBaggage)
+	_, err = cfg.C.R().SetContext(ctx).Get("/")
+	require.NoError(t, err)
+	assert.Empty(t, header.Values(common.HeaderXForwardedFor))
+	assert.Equal(t, []string{"k=v"}, header.Values(common.HeaderBaggage))
+	assert.Equal(t, []string{"custom"}, header.Values("x-custom"))
+}
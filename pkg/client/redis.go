@@ -2,11 +2,14 @@ package client
 
 import (
 	"context"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/KyberNetwork/kutils/klog"
 	"github.com/KyberNetwork/kyber-trace-go/pkg/metric"
 	"github.com/KyberNetwork/kyber-trace-go/pkg/tracer"
+	"github.com/pkg/errors"
 	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 
@@ -18,36 +21,130 @@ const RedisCloseDelay = time.Minute
 // RedisCfg is hotcfg for redis client. On update, it
 // creates FailoverClusterClient with RouteRandomly for sentinel redis by default
 // as well as instrumenting the client for metrics and tracing.
+// The new client must answer PING within Reload.ValidateTimeout to replace the previous one, which is closed once
+// drained per Reload.
 type RedisCfg struct {
 	redis.UniversalOptions `mapstructure:",squash"`
 	DisableRouteRandomly   bool
+	Reload                 ReloadCfg
 	C                      redis.UniversalClient
+
+	inFlight *atomic.Int64 // in-flight commands of C
 }
 
 func (*RedisCfg) OnUpdate(old, new *RedisCfg) {
 	ctx := context.Background()
-	if old != nil && old.C != nil {
-		oldC := old.C
-		time.AfterFunc(RedisCloseDelay, func() {
-			if err := oldC.Close(); err != nil {
-				klog.Errorf(ctx, "RedisCfg.OnUpdate|old.C.Close() failed|err=%v", err)
-			}
-		})
+	var oldC redis.UniversalClient
+	if old != nil {
+		oldC = old.C
 	}
 	new.RouteRandomly = new.RouteRandomly || !new.DisableRouteRandomly
-	new.C = NewRedisClient(ctx, &new.UniversalOptions)
+	inFlight := &atomic.Int64{}
+	client := newRedisClient(ctx, &new.UniversalOptions, inFlightHook{inFlight: inFlight})
+	var err error
+	if oldC != nil {
+		if err = new.validate(ctx, client); err != nil {
+			_ = client.Close()
+		}
+	}
+	recordReload(ctx, new.name(), err, old.name())
+	if err != nil {
+		new.C, new.inFlight = oldC, old.inFlight
+		return
+	}
+
+	new.C, new.inFlight = client, inFlight
+	if oldC != nil {
+		var oldInFlight func() int64
+		if old.inFlight != nil {
+			oldInFlight = old.inFlight.Load
+		}
+		drain(ctx, old.name(), new.Reload.drainTimeout(RedisCloseDelay), oldInFlight, oldC.Close)
+	}
+}
+
+// keep takes over the client of old, for configs whose reload failed for another reason, so that the client is
+// replaced or closed on the next reload.
+func (c *RedisCfg) keep(old *RedisCfg) {
+	if c != nil && old != nil {
+		c.C, c.inFlight = old.C, old.inFlight
+	}
+}
+
+// close closes the client of c once drained, for configs whose redis config is removed by a reload.
+func (c *RedisCfg) close() {
+	if c == nil || c.C == nil {
+		return
+	}
+	var inFlight func() int64
+	if c.inFlight != nil {
+		inFlight = c.inFlight.Load
+	}
+	drain(context.Background(), c.name(), c.Reload.drainTimeout(RedisCloseDelay), inFlight, c.C.Close)
+}
+
+// validate checks that client can reach redis.
+func (c *RedisCfg) validate(ctx context.Context, client redis.UniversalClient) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Reload.validateTimeout())
+	defer cancel()
+	return errors.Wrapf(client.Ping(ctx).Err(), "RedisCfg.validate %v", c.Addrs)
+}
+
+func (c *RedisCfg) name() string {
+	if c == nil {
+		return ""
+	}
+	return "RedisCfg " + strings.Join(c.Addrs, ",")
 }
 
 func NewRedisClient(ctx context.Context, opts *redis.UniversalOptions) redis.UniversalClient {
+	return newRedisClient(ctx, opts)
+}
+
+// newRedisClient creates a redis client per opts with hooks added, including to clients recreated on reconnection.
+func newRedisClient(ctx context.Context, opts *redis.UniversalOptions, hooks ...redis.Hook) redis.UniversalClient {
 	if opts.MasterName == "" {
 		return reconredis.New(func() redis.UniversalClient {
-			return InstrumentRedisOtel(ctx, redis.NewUniversalClient(opts))
+			client := redis.NewUniversalClient(opts)
+			for _, hook := range hooks {
+				client.AddHook(hook)
+			}
+			return InstrumentRedisOtel(ctx, client)
 		})
 	}
 	failoverOpts := opts.Failover()
 	failoverOpts.RouteByLatency = opts.RouteByLatency
 	failoverOpts.RouteRandomly = opts.RouteRandomly
-	return InstrumentRedisOtel(ctx, redis.NewFailoverClusterClient(failoverOpts))
+	client := redis.NewFailoverClusterClient(failoverOpts)
+	for _, hook := range hooks {
+		client.AddHook(hook)
+	}
+	return InstrumentRedisOtel(ctx, client)
+}
+
+// inFlightHook counts in-flight redis commands and pipelines.
+type inFlightHook struct {
+	inFlight *atomic.Int64
+}
+
+func (h inFlightHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h inFlightHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.inFlight.Add(1)
+		defer h.inFlight.Add(-1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h inFlightHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.inFlight.Add(1)
+		defer h.inFlight.Add(-1)
+		return next(ctx, cmds)
+	}
 }
 
 func InstrumentRedisOtel(ctx context.Context, client redis.UniversalClient) redis.UniversalClient {
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+
+	"github.com/KyberNetwork/service-framework/pkg/common"
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+)
+
+const (
+	defaultValidateTimeout = 5 * time.Second
+	drainGracePeriod       = time.Second // min time before closing a replaced client, for callers that just loaded it
+	drainCheckInterval     = 100 * time.Millisecond
+
+	reloadCodeError = "error"
+)
+
+// ReloadCfg configures how a client is replaced on config update. The new client is dialed and validated first, and
+// the previous client is kept if that fails. A replaced client is closed once its in-flight calls finish, or when
+// DrainTimeout passes, whichever comes first.
+type ReloadCfg struct {
+	DrainTimeout    time.Duration // max time to wait for in-flight calls before closing a replaced client, default 1m
+	ValidateTimeout time.Duration // timeout to validate a new client, default 5s
+}
+
+func (c ReloadCfg) drainTimeout(defaultTimeout time.Duration) time.Duration {
+	if c.DrainTimeout <= 0 {
+		return defaultTimeout
+	}
+	return c.DrainTimeout
+}
+
+func (c ReloadCfg) validateTimeout() time.Duration {
+	if c.ValidateTimeout <= 0 {
+		return defaultValidateTimeout
+	}
+	return c.ValidateTimeout
+}
+
+// ReloadHealthService is the grpc health service of servers reporting ReloadHealth.
+const ReloadHealthService = "client.reload"
+
+func init() {
+	common.RegisterHealthCheck(ReloadHealthService, func(context.Context) error { return ReloadHealth() })
+}
+
+// reloadErrs holds the last reload error of each client that failed to reload, by client name.
+var reloadErrs sync.Map
+
+// ReloadHealth returns the errors of clients whose last reload failed and are still using their previous client, or
+// nil if all reloads succeeded. Servers report it as the ReloadHealthService grpc health service.
+func ReloadHealth() error {
+	var errs []error
+	reloadErrs.Range(func(_, err any) bool {
+		errs = append(errs, err.(error))
+		return true
+	})
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// urlHost returns the host of rawUrl to name clients in metrics and logs, excluding credentials and api keys in url
+// paths or query params, or REDACTED if rawUrl has no host.
+func urlHost(rawUrl string) string {
+	if rawUrl == "" {
+		return ""
+	}
+	if u, err := url.Parse(rawUrl); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return redacted
+}
+
+// recordReload records the outcome of reloading the named client in logs, metrics and ReloadHealth. On success, it
+// also clears the failure recorded for oldName, the name of the previous config whose reload may have failed.
+func recordReload(ctx context.Context, name string, err error, oldName string) {
+	code := codeOk
+	if err != nil {
+		code = reloadCodeError
+		klog.Errorf(ctx, "client.recordReload|failed to reload client|name=%s|err=%v", name, err)
+		reloadErrs.Store(name, fmt.Errorf("%s: %w", name, err))
+	} else {
+		reloadErrs.Delete(name)
+		reloadErrs.Delete(oldName)
+	}
+	kmetric.IncClientReload(ctx, kmetric.AttrTarget, name, kmetric.AttrCode, code)
+}
+
+// drain closes a replaced client once inFlight drops to 0 or timeout passes. If inFlight is nil, the client is closed
+// once timeout passes.
+func drain(ctx context.Context, name string, timeout time.Duration, inFlight func() int64, closeFn func() error) {
+	go func() {
+		deadline := time.NewTimer(timeout)
+		defer deadline.Stop()
+		if inFlight != nil {
+			time.Sleep(min(drainGracePeriod, timeout))
+			ticker := time.NewTicker(drainCheckInterval)
+			defer ticker.Stop()
+		loop:
+			for inFlight() > 0 {
+				select {
+				case <-deadline.C:
+					klog.Warnf(ctx, "client.drain|closing client with in-flight calls|name=%s|inFlight=%d", name,
+						inFlight())
+					break loop
+				case <-ticker.C:
+				}
+			}
+		} else {
+			<-deadline.C
+		}
+		if err := closeFn(); err != nil {
+			klog.Errorf(ctx, "client.drain|failed to close replaced client|name=%s|err=%v", name, err)
+		}
+	}()
+}
+
+// inFlightTransport counts in-flight http requests until their response bodies are closed.
+type inFlightTransport struct {
+	base     http.RoundTripper
+	inFlight *atomic.Int64
+}
+
+func (t *inFlightTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.inFlight.Add(1)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.inFlight.Add(-1)
+		return nil, err
+	}
+	resp.Body = &inFlightBody{ReadCloser: resp.Body, done: func() { t.inFlight.Add(-1) }}
+	return resp, nil
+}
+
+type inFlightBody struct {
+	io.ReadCloser
+	done     func()
+	doneOnce sync.Once
+}
+
+func (b *inFlightBody) Close() error {
+	b.doneOnce.Do(b.done)
+	return b.ReadCloser.Close()
+}
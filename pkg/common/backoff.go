@@ -0,0 +1,65 @@
+package common
+
+import (
+	"github.com/cenkalti/backoff/v4"
+)
+
+// BackoffCfg is a hotcfg to create a backoff.ExponentialBackOff
+type BackoffCfg struct {
+	backoff.ExponentialBackOff `mapstructure:",squash"`
+	MaxRetries                 uint64
+	backoff.BackOff
+}
+
+func (b *BackoffCfg) OnUpdate(_, new *BackoffCfg) {
+	new.BackOff = new.NewBackOff()
+}
+
+// Merge returns a copy of b with its unset fields set to the ones of parent.
+func (b *BackoffCfg) Merge(parent *BackoffCfg) *BackoffCfg {
+	merged := &BackoffCfg{ExponentialBackOff: parent.ExponentialBackOff, MaxRetries: parent.MaxRetries}
+	if b.InitialInterval != 0 {
+		merged.InitialInterval = b.InitialInterval
+	}
+	if b.RandomizationFactor != 0 {
+		merged.RandomizationFactor = b.RandomizationFactor
+	}
+	if b.Multiplier != 0 {
+		merged.Multiplier = b.Multiplier
+	}
+	if b.MaxInterval != 0 {
+		merged.MaxInterval = b.MaxInterval
+	}
+	if b.MaxElapsedTime != 0 {
+		merged.MaxElapsedTime = b.MaxElapsedTime
+	}
+	if b.MaxRetries != 0 {
+		merged.MaxRetries = b.MaxRetries
+	}
+	return merged
+}
+
+// WithDefaults returns a copy of b with its unset fields set to the defaults of backoff.NewExponentialBackOff.
+func (b *BackoffCfg) WithDefaults() *BackoffCfg {
+	return b.Merge(&BackoffCfg{ExponentialBackOff: *backoff.NewExponentialBackOff()})
+}
+
+// NewBackOff creates a new backoff.BackOff per the config. Unlike the shared BackOff, it can be used concurrently
+// with other ones created by this method.
+func (b *BackoffCfg) NewBackOff() backoff.BackOff {
+	cfg := b.WithDefaults()
+	expBackoff := &cfg.ExponentialBackOff
+	expBackoff.Reset()
+	if cfg.MaxRetries != 0 {
+		return backoff.WithMaxRetries(expBackoff, cfg.MaxRetries)
+	}
+	return expBackoff
+}
+
+func (b *BackoffCfg) Retry(o backoff.Operation) error {
+	return backoff.Retry(o, b.BackOff)
+}
+
+func (b *BackoffCfg) RetryNotify(o backoff.Operation, n backoff.Notify) error {
+	return backoff.RetryNotify(o, b.BackOff, n)
+}
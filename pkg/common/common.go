@@ -14,11 +14,26 @@ const (
 	HeaderXClientId     = "x-client-id" // must be lowercase
 	HeaderXTraceId      = "x-trace-id"
 	HeaderXRequestId    = "x-request-id"
+	HeaderXDebug        = "x-debug"
 
 	ClientIdUnknown = "unknown"
 	LogFieldTraceId = "trace_id"
+
+	FieldNameRequestId = "request_id" // field of error details and responses set to the trace id by servers
 )
 
+// HttpMarshalerOptions config for http marshaler
+type HttpMarshalerOptions struct { // http marshaler options. see google.golang.org/protobuf/encoding/protojson
+	DisallowUnknown  bool   // disallow unknown fields in request
+	AllowPartialReq  bool   // allow missing required fields in request
+	AllowPartialResp bool   // allow missing required fields in response
+	Multiline        bool   // multiline response
+	Indent           string // indent for multiline
+	UseProtoNames    bool   // use proto names instead of lowerCamelCase
+	UseEnumNumbers   bool   // use enum number instead of name
+	EmitUnpopulated  bool   // emit unpopulated fields with zero values
+}
+
 func TraceIdFromCtx(ctx context.Context) (*trace.TraceID, bool) {
 	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
 		traceId := span.TraceID()
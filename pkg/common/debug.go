@@ -0,0 +1,58 @@
+package common
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ctxKeyDebug struct{}
+
+// CtxWithDebug marks ctx as a debug call, keeping the verified x-debug header value to propagate to outgoing calls.
+func CtxWithDebug(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, ctxKeyDebug{}, token)
+}
+
+// DebugFromCtx returns the x-debug header value if ctx was marked as a debug call.
+func DebugFromCtx(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(ctxKeyDebug{}).(string)
+	return token, ok
+}
+
+// IsDebug checks whether ctx was marked as a debug call.
+func IsDebug(ctx context.Context) bool {
+	_, ok := DebugFromCtx(ctx)
+	return ok
+}
+
+// SignDebugToken returns an x-debug header value that is valid until expiry, signed with secret.
+func SignDebugToken(secret string, expiry time.Time) string {
+	expiryStr := strconv.FormatInt(expiry.Unix(), 10)
+	return expiryStr + "." + debugTokenSignature(secret, expiryStr)
+}
+
+// VerifyDebugToken checks that token was signed with secret by SignDebugToken and has not expired at now.
+func VerifyDebugToken(secret, token string, now time.Time) bool {
+	if secret == "" {
+		return false
+	}
+	expiryStr, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expiry, err := strconv.ParseInt(expiryStr, 10, 64)
+	if err != nil || now.Unix() > expiry {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(debugTokenSignature(secret, expiryStr)))
+}
+
+func debugTokenSignature(secret, expiryStr string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(expiryStr))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyDebugToken(t *testing.T) {
+	now := time.Now()
+	token := SignDebugToken("secret", now.Add(time.Minute))
+
+	assert.True(t, VerifyDebugToken("secret", token, now))
+	assert.False(t, VerifyDebugToken("other", token, now))
+	assert.False(t, VerifyDebugToken("", token, now))
+	assert.False(t, VerifyDebugToken("secret", token, now.Add(2*time.Minute)))
+	assert.False(t, VerifyDebugToken("secret", "1", now))
+	assert.False(t, VerifyDebugToken("secret", token+"0", now))
+}
+
+func TestCtxWithDebug(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, IsDebug(ctx))
+
+	ctx = CtxWithDebug(ctx, "token")
+	token, ok := DebugFromCtx(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "token", token)
+}
@@ -0,0 +1,28 @@
+package common
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+var (
+	healthChecksMu sync.RWMutex
+	healthChecks   = map[string]func(context.Context) error{}
+)
+
+// RegisterHealthCheck registers check to report the health of the named grpc health service of servers, such as the
+// reload health of clients. The overall health of servers (the empty service) is not affected, so that failing checks
+// do not take all replicas out of service at once; probes should check the named service to act on it.
+func RegisterHealthCheck(service string, check func(context.Context) error) {
+	healthChecksMu.Lock()
+	defer healthChecksMu.Unlock()
+	healthChecks[service] = check
+}
+
+// HealthChecks returns the health checks registered by RegisterHealthCheck by service name.
+func HealthChecks() map[string]func(context.Context) error {
+	healthChecksMu.RLock()
+	defer healthChecksMu.RUnlock()
+	return maps.Clone(healthChecks)
+}
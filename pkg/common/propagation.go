@@ -0,0 +1,72 @@
+package common
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	HeaderBaggage        = "baggage"
+	HeaderXForwardedHost = "x-forwarded-host"
+)
+
+// PropagatedHeaders returns the incoming headers copied into outgoing grpc calls by default. x-client-id is not
+// propagated as outgoing calls identify the service itself, x-trace-id is superseded by trace context propagation and
+// x-debug is propagated via CtxWithDebug.
+func PropagatedHeaders() []string {
+	return []string{HeaderXRequestId, HeaderXForwardedFor, HeaderBaggage}
+}
+
+type ctxKeyPassThruHeaders struct{}
+
+// CtxWithPassThruHeaders sets the incoming headers that the server of an incoming call passes through from http to
+// grpc, to also be propagated to outgoing grpc calls made with ctx.
+func CtxWithPassThruHeaders(ctx context.Context, headers []string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKeyPassThruHeaders{}, headers)
+}
+
+// PassThruHeadersFromCtx returns the headers set by CtxWithPassThruHeaders.
+func PassThruHeadersFromCtx(ctx context.Context) []string {
+	headers, _ := ctx.Value(ctxKeyPassThruHeaders{}).([]string)
+	return headers
+}
+
+// HeadersToPropagate returns the values of the given headers found in the incoming metadata of ctx, to be copied into
+// outgoing calls. If x-forwarded-for is one of them, the address of the incoming peer is appended to it, unless the
+// call was proxied by grpc-gateway which already appended the address of the http client.
+func HeadersToPropagate(ctx context.Context, headers []string) map[string][]string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := make(map[string][]string)
+	forwardedFor := false
+	for _, header := range headers {
+		header = strings.ToLower(header)
+		if header == HeaderXForwardedFor {
+			forwardedFor = true
+		}
+		if headerValues := md.Get(header); len(headerValues) != 0 {
+			values[header] = slices.Clone(headerValues)
+		}
+	}
+	if !forwardedFor || len(md.Get(HeaderXForwardedHost)) != 0 {
+		return values
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			values[HeaderXForwardedFor] = []string{appendForwardedFor(values[HeaderXForwardedFor], host)}
+		}
+	}
+	return values
+}
+
+// appendForwardedFor appends addr to the comma-separated list of x-forwarded-for values.
+func appendForwardedFor(values []string, addr string) string {
+	return strings.Join(append(slices.Clone(values), addr), ", ")
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestHeadersToPropagate(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		HeaderXRequestId, "req-1",
+		HeaderXForwardedFor, "1.1.1.1",
+		HeaderXClientId, "caller",
+		HeaderBaggage, "k=v",
+		"x-custom", "custom",
+	))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+
+	assert.Equal(t, map[string][]string{
+		HeaderXRequestId:    {"req-1"},
+		HeaderXForwardedFor: {"1.1.1.1, 10.0.0.1"},
+		HeaderBaggage:       {"k=v"},
+		"x-custom":          {"custom"},
+	}, HeadersToPropagate(ctx, append(PropagatedHeaders(), "X-Custom")))
+
+	t.Run("only given headers", func(t *testing.T) {
+		assert.Equal(t, map[string][]string{HeaderXRequestId: {"req-1"}},
+			HeadersToPropagate(ctx, []string{HeaderXRequestId}), "no client address without x-forwarded-for")
+		assert.Empty(t, HeadersToPropagate(ctx, nil))
+	})
+
+	t.Run("gateway already appended http client address", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(ctx, metadata.Pairs(
+			HeaderXForwardedFor, "1.1.1.1, 2.2.2.2",
+			HeaderXForwardedHost, "api.example.com",
+		))
+		assert.Equal(t, map[string][]string{HeaderXForwardedFor: {"1.1.1.1, 2.2.2.2"}},
+			HeadersToPropagate(ctx, PropagatedHeaders()))
+	})
+
+	t.Run("no incoming call", func(t *testing.T) {
+		assert.Empty(t, HeadersToPropagate(context.Background(), PropagatedHeaders()))
+	})
+}
+
+func TestPassThruHeadersFromCtx(t *testing.T) {
+	assert.Nil(t, PassThruHeadersFromCtx(context.Background()))
+	ctx := CtxWithPassThruHeaders(context.Background(), []string{"x-custom"})
+	assert.Equal(t, []string{"x-custom"}, PassThruHeadersFromCtx(ctx))
+}
@@ -0,0 +1,138 @@
+// Package kmetrictest reads the metrics recorded via kmetric in tests.
+package kmetrictest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	kybermetric "github.com/KyberNetwork/kyber-trace-go/pkg/metric"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var (
+	meterReader     = sdkmetric.NewManualReader()
+	meterReaderOnce sync.Once
+)
+
+// EnsureMeterProvider installs a global meter provider read by Collect, unless kyber-trace-go has installed one.
+func EnsureMeterProvider() {
+	meterReaderOnce.Do(func() {
+		if kybermetric.Provider() == nil {
+			otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(meterReader)))
+		}
+	})
+}
+
+// Collect collects the metrics recorded so far. As metrics are process-wide, they include those of other tests in the
+// same process: compare values before and after the calls under test, or filter by attributes unique to a test.
+func Collect(t testing.TB) metricdata.ResourceMetrics {
+	t.Helper()
+	EnsureMeterProvider()
+	var resourceMetrics metricdata.ResourceMetrics
+	if err := meterReader.Collect(context.Background(), &resourceMetrics); err != nil &&
+		!errors.Is(err, sdkmetric.ErrReaderNotRegistered) {
+		t.Fatalf("kmetrictest.Collect: %v", err)
+	}
+	return resourceMetrics
+}
+
+// CounterValue returns the sum of the data points of the named int64 counter having all the given attributes.
+func CounterValue(t testing.TB, name string, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+	var value int64
+	forEachMetric(Collect(t), name, func(data metricdata.Aggregation) {
+		if sum, ok := data.(metricdata.Sum[int64]); ok {
+			for _, dataPoint := range sum.DataPoints {
+				if HasAttributes(dataPoint.Attributes, attrs...) {
+					value += dataPoint.Value
+				}
+			}
+		}
+	})
+	return value
+}
+
+// CounterDelta returns a function returning the increase of CounterValue since CounterDelta was called.
+func CounterDelta(t testing.TB, name string, attrs ...attribute.KeyValue) func() int64 {
+	t.Helper()
+	before := CounterValue(t, name, attrs...)
+	return func() int64 {
+		t.Helper()
+		return CounterValue(t, name, attrs...) - before
+	}
+}
+
+// HistogramCountDelta returns a function returning the increase of HistogramCount since HistogramCountDelta was
+// called.
+func HistogramCountDelta(t testing.TB, name string, attrs ...attribute.KeyValue) func() uint64 {
+	t.Helper()
+	before := HistogramCount(t, name, attrs...)
+	return func() uint64 {
+		t.Helper()
+		return HistogramCount(t, name, attrs...) - before
+	}
+}
+
+// HistogramCount returns the number of values recorded by the named histogram with all the given attributes.
+func HistogramCount(t testing.TB, name string, attrs ...attribute.KeyValue) uint64 {
+	t.Helper()
+	var count uint64
+	forEachMetric(Collect(t), name, func(data metricdata.Aggregation) {
+		switch histogram := data.(type) {
+		case metricdata.Histogram[int64]:
+			for _, dataPoint := range histogram.DataPoints {
+				if HasAttributes(dataPoint.Attributes, attrs...) {
+					count += dataPoint.Count
+				}
+			}
+		case metricdata.Histogram[float64]:
+			for _, dataPoint := range histogram.DataPoints {
+				if HasAttributes(dataPoint.Attributes, attrs...) {
+					count += dataPoint.Count
+				}
+			}
+		}
+	})
+	return count
+}
+
+// HistogramSum returns the sum of the values recorded by the named int64 histogram with all the given attributes.
+func HistogramSum(t testing.TB, name string, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+	var sum int64
+	forEachMetric(Collect(t), name, func(data metricdata.Aggregation) {
+		if histogram, ok := data.(metricdata.Histogram[int64]); ok {
+			for _, dataPoint := range histogram.DataPoints {
+				if HasAttributes(dataPoint.Attributes, attrs...) {
+					sum += dataPoint.Sum
+				}
+			}
+		}
+	})
+	return sum
+}
+
+func forEachMetric(resourceMetrics metricdata.ResourceMetrics, name string, fn func(metricdata.Aggregation)) {
+	for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+		for _, m := range scopeMetrics.Metrics {
+			if m.Name == name {
+				fn(m.Data)
+			}
+		}
+	}
+}
+
+// HasAttributes checks whether set has all the given attributes.
+func HasAttributes(set attribute.Set, attrs ...attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if value, ok := set.Value(attr.Key); !ok || value != attr.Value {
+			return false
+		}
+	}
+	return true
+}
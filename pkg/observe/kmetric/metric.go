@@ -17,12 +17,31 @@ var (
 	PanicCounter          = "panic"
 	IncomingRequest       = "incoming_request"
 	OutgoingRequest       = "outgoing_request"
+	OutgoingRequestRetry  = "outgoing_request_retry"
+	OutgoingDuration      = "outgoing_request_duration"
+	OutgoingRequestSize   = "outgoing_request_size"
+	OutgoingResponseSize  = "outgoing_response_size"
+	CircuitBreakerState   = "circuit_breaker_state_change"
+	ClientReload          = "client_reload"
+	EndpointHealth        = "endpoint_health"
+	EndpointBlockLag      = "endpoint_block_lag"
+	EthBatchCall          = "eth_batch_call"
+	EthBatchWait          = "eth_batch_wait"
+	EthBatchSize          = "eth_batch_size"
 	TaskExecutionDuration = "task_execution_duration"
 
-	AttrServerName = "server.name"
-	AttrClientName = "client.name"
-	AttrMethod     = "method"
-	AttrCode       = "code"
+	AttrServerName  = "server.name"
+	AttrClientName  = "client.name"
+	AttrMethod      = "method"
+	AttrCode        = "code"
+	AttrAppCode     = "app_code"
+	AttrAttempt     = "attempt"
+	AttrTarget      = "target"
+	AttrState       = "state"
+	AttrRoute       = "route"
+	AttrStatusClass = "status_class"
+	AttrEndpoint    = "endpoint"
+	AttrRole        = "role"
 )
 
 var (
@@ -38,6 +57,28 @@ var (
 		metric.WithDescription("Counter of incoming requests")))
 	outgoingRequestCounter = noErr(kybermetric.Meter().Int64Counter(OutgoingRequest,
 		metric.WithDescription("Counter of outgoing requests")))
+	outgoingDurationHistogram = noErr(kybermetric.Meter().Float64Histogram(OutgoingDuration,
+		metric.WithUnit("ms"), metric.WithDescription("Histogram of outgoing request durations")))
+	outgoingRequestSizeHistogram = noErr(kybermetric.Meter().Int64Histogram(OutgoingRequestSize,
+		metric.WithUnit("By"), metric.WithDescription("Histogram of outgoing request sizes")))
+	outgoingResponseSizeHistogram = noErr(kybermetric.Meter().Int64Histogram(OutgoingResponseSize,
+		metric.WithUnit("By"), metric.WithDescription("Histogram of outgoing response sizes")))
+	outgoingRequestRetryCounter = noErr(kybermetric.Meter().Int64Counter(OutgoingRequestRetry,
+		metric.WithDescription("Counter of retried or hedged outgoing request attempts")))
+	circuitBreakerStateCounter = noErr(kybermetric.Meter().Int64Counter(CircuitBreakerState,
+		metric.WithDescription("Counter of circuit breaker state changes")))
+	clientReloadCounter = noErr(kybermetric.Meter().Int64Counter(ClientReload,
+		metric.WithDescription("Counter of client reloads on config update")))
+	endpointHealthGauge = noErr(kybermetric.Meter().Float64Gauge(EndpointHealth,
+		metric.WithDescription("Health score in [0, 1] of client endpoints")))
+	endpointBlockLagGauge = noErr(kybermetric.Meter().Int64Gauge(EndpointBlockLag,
+		metric.WithDescription("Head block lag of client endpoints behind the highest head block")))
+	ethBatchCallCounter = noErr(kybermetric.Meter().Int64Counter(EthBatchCall,
+		metric.WithDescription("Counter of batched eth json-rpc calls")))
+	ethBatchWaitHistogram = noErr(kybermetric.Meter().Float64Histogram(EthBatchWait,
+		metric.WithUnit("ms"), metric.WithDescription("Histogram of batched eth json-rpc call queue wait durations")))
+	ethBatchSizeHistogram = noErr(kybermetric.Meter().Int64Histogram(EthBatchSize,
+		metric.WithDescription("Histogram of eth json-rpc batch sizes")))
 	taskExecutionDurationHistogram = noErr(kybermetric.Meter().Float64Histogram(TaskExecutionDuration,
 		metric.WithUnit("ms"), metric.WithDescription("Histogram of task execution durations")))
 )
@@ -57,12 +98,66 @@ func IncIncomingRequest(ctx context.Context, clientId, method string, code codes
 }
 
 func IncOutgoingRequest(ctx context.Context, keyValues ...string) {
+	outgoingRequestCounter.Add(ctx, 1, metric.WithAttributes(clientAttributes(keyValues)...))
+}
+
+// clientAttributes returns the client name attribute followed by attributes from the given key value pairs.
+func clientAttributes(keyValues []string) []attribute.KeyValue {
 	attributes := make([]attribute.KeyValue, 1+len(keyValues)/2)
 	attributes[0] = clientNameAttr
 	for i := 1; i < len(keyValues); i += 2 {
 		attributes[i/2+1] = attribute.String(keyValues[i-1], keyValues[i])
 	}
-	outgoingRequestCounter.Add(ctx, 1, metric.WithAttributes(attributes...))
+	return attributes
+}
+
+// RecordOutgoingRequest increments the outgoing request counter and records the request duration.
+func RecordOutgoingRequest(ctx context.Context, duration time.Duration, keyValues ...string) {
+	attributes := metric.WithAttributes(clientAttributes(keyValues)...)
+	outgoingRequestCounter.Add(ctx, 1, attributes)
+	outgoingDurationHistogram.Record(ctx, float64(duration)/float64(time.Millisecond), attributes)
+}
+
+// RecordOutgoingSizes records the sizes of an outgoing request and its response. Negative (unknown) sizes are skipped.
+func RecordOutgoingSizes(ctx context.Context, requestSize, responseSize int64, keyValues ...string) {
+	attributes := metric.WithAttributes(clientAttributes(keyValues)...)
+	if requestSize >= 0 {
+		outgoingRequestSizeHistogram.Record(ctx, requestSize, attributes)
+	}
+	if responseSize >= 0 {
+		outgoingResponseSizeHistogram.Record(ctx, responseSize, attributes)
+	}
+}
+
+func IncOutgoingRequestRetry(ctx context.Context, keyValues ...string) {
+	outgoingRequestRetryCounter.Add(ctx, 1, metric.WithAttributes(clientAttributes(keyValues)...))
+}
+
+func IncCircuitBreakerStateChange(ctx context.Context, keyValues ...string) {
+	circuitBreakerStateCounter.Add(ctx, 1, metric.WithAttributes(clientAttributes(keyValues)...))
+}
+
+func IncClientReload(ctx context.Context, keyValues ...string) {
+	clientReloadCounter.Add(ctx, 1, metric.WithAttributes(clientAttributes(keyValues)...))
+}
+
+// RecordEndpointHealth records the health score and head block lag of a client endpoint.
+func RecordEndpointHealth(ctx context.Context, score float64, blockLag int64, keyValues ...string) {
+	attributes := metric.WithAttributes(clientAttributes(keyValues)...)
+	endpointHealthGauge.Record(ctx, score, attributes)
+	endpointBlockLagGauge.Record(ctx, blockLag, attributes)
+}
+
+// RecordEthBatchCall increments the batched eth json-rpc call counter and records the call queue wait duration.
+func RecordEthBatchCall(ctx context.Context, wait time.Duration, keyValues ...string) {
+	attributes := metric.WithAttributes(clientAttributes(keyValues)...)
+	ethBatchCallCounter.Add(ctx, 1, attributes)
+	ethBatchWaitHistogram.Record(ctx, float64(wait)/float64(time.Millisecond), attributes)
+}
+
+// RecordEthBatchSize records the size of an eth json-rpc batch.
+func RecordEthBatchSize(ctx context.Context, size int64, keyValues ...string) {
+	ethBatchSizeHistogram.Record(ctx, size, metric.WithAttributes(clientAttributes(keyValues)...))
 }
 
 func PushTaskExecutionDuration(ctx context.Context, duration time.Duration, keyValues ...string) {
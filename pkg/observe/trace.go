@@ -11,6 +11,9 @@ import (
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KyberNetwork/service-framework/pkg/common"
 )
 
 func EnsureTracerProvider() {
@@ -29,9 +32,33 @@ func EnsureTracerProvider() {
 		resources, _ = resource.Merge(resources, extraResources)
 	}
 	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(DebugSampler(sdktrace.ParentBased(sdktrace.AlwaysSample()))),
 		sdktrace.WithResource(resources),
 		sdktrace.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(nil)),
 	)
 	otel.SetTracerProvider(tracerProvider)
 	otel.SetTextMapPropagator(propagation.TraceContext{})
 }
+
+// DebugSampler returns a sampler sampling the spans started within debug calls (see common.CtxWithDebug), and other
+// spans per base. Tracer providers not using it, such as the one of kyber-trace-go, sample debug calls per their own
+// sampler.
+func DebugSampler(base sdktrace.Sampler) sdktrace.Sampler {
+	return debugSampler{base: base}
+}
+
+type debugSampler struct {
+	base sdktrace.Sampler
+}
+
+func (s debugSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if common.IsDebug(p.ParentContext) {
+		return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState()}
+	}
+	return s.base.ShouldSample(p)
+}
+
+func (s debugSampler) Description() string {
+	return "DebugSampler{" + s.base.Description() + "}"
+}
@@ -2,12 +2,16 @@ package grpcserver
 
 import (
 	"context"
+	"crypto/subtle"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 
+	"github.com/KyberNetwork/service-framework/pkg/common"
 	"github.com/KyberNetwork/service-framework/pkg/server/middleware/logging"
 )
 
@@ -36,6 +40,7 @@ type (
 		HTTP     Listen
 		BasePath string
 		Log      Log
+		Debug    Debug
 
 		services           []Service                            // services to register
 		loggingInterceptor logging.InterceptorLogger            // to override default interceptor logger
@@ -46,6 +51,11 @@ type (
 			outgoing []string // outgoing headers (in responses)
 		}
 		httpMarshalerOptions HttpMarshalerOptions
+		tracerProvider       trace.TracerProvider // to override the global tracer provider for server spans
+		gateway              struct {             // how the http gateway reaches the grpc server
+			endpoint    string            // defaults to GRPC listen address
+			dialOptions []grpc.DialOption // defaults to insecure transport credentials
+		}
 	}
 
 	Log struct {
@@ -53,6 +63,12 @@ type (
 		IgnoreResp []string
 	}
 
+	// Debug config for elevating logging and tracing of a single request via the x-debug header
+	Debug struct {
+		Secret string   // secret to verify x-debug tokens signed by common.SignDebugToken
+		Tokens []string // static x-debug values also allowed to elevate, such as for internal tools
+	}
+
 	// Listen config for host/port socket listener
 	Listen struct {
 		Host string
@@ -60,16 +76,7 @@ type (
 	}
 
 	// HttpMarshalerOptions config for http marshaler
-	HttpMarshalerOptions struct { // http marshaler options. see google.golang.org/protobuf/encoding/protojson
-		DisallowUnknown  bool   // disallow unknown fields in request
-		AllowPartialReq  bool   // allow missing required fields in request
-		AllowPartialResp bool   // allow missing required fields in response
-		Multiline        bool   // multiline response
-		Indent           string // indent for multiline
-		UseProtoNames    bool   // use proto names instead of lowerCamelCase
-		UseEnumNumbers   bool   // use enum number instead of name
-		EmitUnpopulated  bool   // emit unpopulated fields with zero values
-	}
+	HttpMarshalerOptions = common.HttpMarshalerOptions
 )
 
 // String return socket listen DSN
@@ -77,6 +84,19 @@ func (l *Listen) String() string {
 	return net.JoinHostPort(l.Host, strconv.Itoa(l.Port))
 }
 
+// Verify checks whether an x-debug header value should elevate the request.
+func (d Debug) Verify(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, allowed := range d.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			return true
+		}
+	}
+	return common.VerifyDebugToken(d.Secret, token, time.Now())
+}
+
 // Apply config options
 func (c Config) Apply(opts ...Opt) Config {
 	for _, opt := range opts {
@@ -102,6 +122,16 @@ func (c Config) GRPCServerOptions() []grpc.ServerOption {
 	return c.grpcServerOptions
 }
 
+func (c Config) TracerProvider() trace.TracerProvider {
+	return c.tracerProvider
+}
+
+// PassThruIncomingHeaders returns the incoming headers passed through from http to grpc in addition to the default
+// ones, which grpc clients also propagate to outgoing calls of requests served by this server.
+func (c Config) PassThruIncomingHeaders() []string {
+	return c.passThruHeaders.incoming
+}
+
 // Opt is an option for server config
 type Opt interface {
 	opt(*Config)
@@ -163,3 +193,18 @@ func WithHTTPMarshalerOptions(options HttpMarshalerOptions) Opt {
 		c.httpMarshalerOptions = options
 	})
 }
+
+// WithTracerProvider overrides the global tracer provider used to create server spans
+func WithTracerProvider(tracerProvider trace.TracerProvider) Opt {
+	return OptFn(func(c *Config) {
+		c.tracerProvider = tracerProvider
+	})
+}
+
+// WithGatewayEndpoint overrides the endpoint and dial options the http gateway uses to reach the grpc server
+func WithGatewayEndpoint(endpoint string, dialOptions ...grpc.DialOption) Opt {
+	return OptFn(func(c *Config) {
+		c.gateway.endpoint = endpoint
+		c.gateway.dialOptions = dialOptions
+	})
+}
@@ -0,0 +1,41 @@
+package grpcserver
+
+import (
+	"context"
+
+	"google.golang.org/grpc/health"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/KyberNetwork/service-framework/pkg/common"
+)
+
+// healthServer is a grpc health server that also reports the health checks registered by common.RegisterHealthCheck
+// under their service names, checked on each Check call of their service.
+type healthServer struct {
+	*health.Server
+}
+
+func newHealthServer() *healthServer {
+	s := &healthServer{Server: health.NewServer()}
+	for service, check := range common.HealthChecks() {
+		s.check(context.Background(), service, check)
+	}
+	return s
+}
+
+func (s *healthServer) Check(ctx context.Context, req *healthv1.HealthCheckRequest) (*healthv1.HealthCheckResponse,
+	error) {
+	if check, ok := common.HealthChecks()[req.GetService()]; ok {
+		s.check(ctx, req.GetService(), check)
+	}
+	return s.Server.Check(ctx, req)
+}
+
+// check runs the health check of service and updates its serving status.
+func (s *healthServer) check(ctx context.Context, service string, check func(context.Context) error) {
+	servingStatus := healthv1.HealthCheckResponse_SERVING
+	if check(ctx) != nil {
+		servingStatus = healthv1.HealthCheckResponse_NOT_SERVING
+	}
+	s.SetServingStatus(service, servingStatus)
+}
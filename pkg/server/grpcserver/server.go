@@ -16,7 +16,6 @@ import (
 	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/health"
 	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -114,15 +113,22 @@ func NewServer(cfg *Config, opt ...grpc.ServerOption) *Server {
 }
 
 func (s *Server) Register(services ...Service) error {
+	endpoint, dialOptions := s.cfg.gateway.endpoint, s.cfg.gateway.dialOptions
+	if endpoint == "" {
+		endpoint = s.cfg.GRPC.String()
+	}
+	if dialOptions == nil {
+		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
 	for _, service := range services {
 		service.RegServer(s.gRPC)
-		if err := service.RegServiceHandlerFromEndpoint(context.Background(), s.mux, s.cfg.GRPC.String(),
-			[]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}); err != nil {
+		if err := service.RegServiceHandlerFromEndpoint(context.Background(), s.mux, endpoint,
+			dialOptions); err != nil {
 			return err
 		}
 	}
 
-	healthv1.RegisterHealthServer(s.gRPC, health.NewServer())
+	healthv1.RegisterHealthServer(s.gRPC, newHealthServer())
 	return nil
 }
 
@@ -142,13 +148,9 @@ func (s *Server) Serve(ctx context.Context) (err error) {
 	}()
 	defer s.gRPC.GracefulStop()
 
-	httpMux := http.NewServeMux()
-	basePath := normalizeBasePath(s.cfg.BasePath)
-	httpMux.Handle(basePath+"/", stripBasePath(s.mux, basePath))
-	h2s := &http2.Server{}
 	httpServer := &http.Server{
 		Addr:    s.cfg.HTTP.String(),
-		Handler: h2c.NewHandler(httpMux, h2s),
+		Handler: s.HTTPHandler(),
 	}
 	go func() {
 		errCh <- httpServer.ListenAndServe()
@@ -172,6 +174,19 @@ func (s *Server) Serve(ctx context.Context) (err error) {
 	}
 }
 
+// GRPCServer returns the grpc server with registered services
+func (s *Server) GRPCServer() *grpc.Server {
+	return s.gRPC
+}
+
+// HTTPHandler returns the http handler serving the grpc gateway under the configured base path, over http/1 and h2c
+func (s *Server) HTTPHandler() http.Handler {
+	httpMux := http.NewServeMux()
+	basePath := normalizeBasePath(s.cfg.BasePath)
+	httpMux.Handle(basePath+"/", stripBasePath(s.mux, basePath))
+	return h2c.NewHandler(httpMux, &http2.Server{})
+}
+
 func normalizeBasePath(path string) string {
 	if path == "" {
 		return ""
@@ -204,6 +219,7 @@ var defaultPassThruHeaders = map[string]struct{}{
 	common.HeaderXClientId:     {},
 	common.HeaderXTraceId:      {},
 	common.HeaderXRequestId:    {},
+	common.HeaderXDebug:        {},
 }
 
 func CustomHeaderMatcher(userHeaders ...string) func(key string) (string, bool) {
@@ -65,6 +65,20 @@ func IgnoreResp(ignoreResp ...string) func(opt *opt) {
 // ignored is a string that indicates that the request or response is ignored.
 const ignored = "<...>"
 
+// filter replaces ignored requests and responses with the ignored placeholder, except for debug calls.
+func (o *opt) filter(ctx context.Context, meta CallMeta, req, resp any) (any, any) {
+	if common.IsDebug(ctx) {
+		return req, resp
+	}
+	if _, ok := o.ignoreReq[meta.FullMethod]; ok {
+		req = ignored
+	}
+	if _, ok := o.ignoreResp[meta.FullMethod]; ok {
+		resp = ignored
+	}
+	return req, resp
+}
+
 // DefaultLogger is the default logging interceptor which logs requests and responses in plain format.
 func DefaultLogger(loggerFromCtx func(context.Context) Logger, opts ...func(opt *opt)) LoggerFunc {
 	if loggerFromCtx == nil {
@@ -75,12 +89,7 @@ func DefaultLogger(loggerFromCtx func(context.Context) Logger, opts ...func(opt
 	opt := newOpt(opts...)
 	return func(ctx context.Context, meta CallMeta, req any, resp any, err error, duration time.Duration) {
 		code := status.Code(err)
-		if _, ok := opt.ignoreReq[meta.FullMethod]; ok {
-			req = ignored
-		}
-		if _, ok := opt.ignoreResp[meta.FullMethod]; ok {
-			resp = ignored
-		}
+		req, resp = opt.filter(ctx, meta, req, resp)
 		from := metadata.ValueFromIncomingContext(ctx, common.HeaderXForwardedFor)
 		if peerInfo, ok := peer.FromContext(ctx); ok {
 			from = append(from, peerInfo.Addr.String())
@@ -101,12 +110,7 @@ func FieldsLogger(loggerFromCtx func(context.Context) klog.Logger, opts ...func(
 	opt := newOpt(opts...)
 	return func(ctx context.Context, meta CallMeta, req any, resp any, err error, duration time.Duration) {
 		code := status.Code(err)
-		if _, ok := opt.ignoreReq[meta.FullMethod]; ok {
-			req = ignored
-		}
-		if _, ok := opt.ignoreResp[meta.FullMethod]; ok {
-			resp = ignored
-		}
+		req, resp = opt.filter(ctx, meta, req, resp)
 		from := metadata.ValueFromIncomingContext(ctx, common.HeaderXForwardedFor)
 		if peerInfo, ok := peer.FromContext(ctx); ok {
 			from = append(from, peerInfo.Addr.String())
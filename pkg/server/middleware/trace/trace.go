@@ -19,7 +19,7 @@ import (
 	"github.com/KyberNetwork/service-framework/pkg/server/grpcserver"
 )
 
-const FieldNameRequestId = "request_id"
+const FieldNameRequestId = common.FieldNameRequestId
 
 var internalServerErr = status.New(codes.Internal, http.StatusText(http.StatusInternalServerError))
 
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 
 	"github.com/KyberNetwork/service-framework/pkg/server/grpcserver"
@@ -48,3 +49,13 @@ func WithPassThruOutgoingHeaders(headers ...string) Opt {
 func WithHTTPMarshalerOptions(options grpcserver.HttpMarshalerOptions) Opt {
 	return grpcserver.WithHTTPMarshalerOptions(options)
 }
+
+// WithTracerProvider overrides the global tracer provider used to trace incoming requests
+func WithTracerProvider(tp trace.TracerProvider) Opt {
+	return grpcserver.WithTracerProvider(tp)
+}
+
+// WithGatewayEndpoint overrides the grpc endpoint and dial options used by the http gateway to reach the grpc server
+func WithGatewayEndpoint(endpoint string, dialOptions ...grpc.DialOption) Opt {
+	return grpcserver.WithGatewayEndpoint(endpoint, dialOptions...)
+}
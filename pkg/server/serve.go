@@ -42,12 +42,27 @@ func Serve(ctx context.Context, cfg grpcserver.Config, opts ...grpcserver.Opt) {
 	ctxWithoutCancel := kutils.CtxWithoutCancel(ctx)
 	defer shutdownKyberTrace(ctxWithoutCancel)
 
+	s, err := NewServer(ctx, cfg, opts...)
+	if err != nil {
+		klog.Fatalf(ctx, "Error register servers %v", err)
+	}
+
+	if err := s.Serve(ctx); err != nil {
+		klog.Fatalf(ctx, "Error start server %v", err)
+	}
+}
+
+// NewServer creates the gRPC server and HTTP grpc gateway server served by Serve, with the same interceptors (trace,
+// logging, protovalidate, recovery) and registered services, without listening. It allows serving them on custom
+// listeners, e.g. in tests.
+func NewServer(ctx context.Context, cfg grpcserver.Config, opts ...grpcserver.Opt) (*grpcserver.Server, error) {
+	ctxWithoutCancel := kutils.CtxWithoutCancel(ctx)
 	cfg = cfg.Apply(opts...)
 
 	loggingLogger := cfg.LoggingInterceptor()
 	validator, err := protovalidate.New(legacy.WithLegacySupport(legacy.ModeMerge))
 	if err != nil {
-		panic(err)
+		return nil, errors.Wrapf(err, "create protovalidate validator")
 	}
 	recoveryOpt := recovery.WithRecoveryHandler(func(p any) error {
 		err := errors.Errorf("%v", p) // use github.com/pkg/errors for stack trace
@@ -62,7 +77,7 @@ func Serve(ctx context.Context, cfg grpcserver.Config, opts ...grpcserver.Opt) {
 		return err
 	})
 
-	otelGrpcStatHandler := getOtelGrpcStatsHandler()
+	otelGrpcStatHandler := getOtelGrpcStatsHandler(cfg)
 	unaryOpts := []grpc.UnaryServerInterceptor{
 		unaryHealthSkip(trace.UnaryServerInterceptor(cfg)),
 		unaryHealthSkip(logging.UnaryServerInterceptor(loggingLogger)),
@@ -82,14 +97,10 @@ func Serve(ctx context.Context, cfg grpcserver.Config, opts ...grpcserver.Opt) {
 	}, cfg.GRPCServerOptions()...)
 
 	s := grpcserver.NewServer(&cfg, serverOptions...)
-
 	if err := s.Register(cfg.Services()...); err != nil {
-		klog.Fatalf(ctx, "Error register servers %v", err)
-	}
-
-	if err := s.Serve(ctx); err != nil {
-		klog.Fatalf(ctx, "Error start server %v", err)
+		return nil, err
 	}
+	return s, nil
 }
 
 var healthSkipMatchFunc = selector.MatchFunc(func(_ context.Context, c interceptors.CallMeta) bool {
@@ -104,27 +115,42 @@ func streamHealthSkip(interceptor grpc.StreamServerInterceptor) grpc.StreamServe
 	return selector.StreamServerInterceptor(interceptor, healthSkipMatchFunc)
 }
 
-func getOtelGrpcStatsHandler() stats.Handler {
+func getOtelGrpcStatsHandler(cfg grpcserver.Config) stats.Handler {
 	observe.EnsureTracerProvider()
 	propagator := otel.GetTextMapPropagator()
-	propagator = &requestIdExtractor{propagator}
-	return &OtelServerHandler{otelgrpc.NewServerHandler(otelgrpc.WithPropagators(propagator))}
+	propagator = &requestIdExtractor{TextMapPropagator: propagator, debug: cfg.Debug,
+		passThruHeaders: cfg.PassThruIncomingHeaders()}
+	otelOpts := []otelgrpc.Option{otelgrpc.WithPropagators(propagator)}
+	if tracerProvider := cfg.TracerProvider(); tracerProvider != nil {
+		otelOpts = append(otelOpts, otelgrpc.WithTracerProvider(tracerProvider))
+	}
+	return &OtelServerHandler{otelgrpc.NewServerHandler(otelOpts...)}
 }
 
 type requestIdExtractor struct {
 	propagation.TextMapPropagator
+	debug           grpcserver.Debug
+	passThruHeaders []string // custom incoming headers for grpc clients to propagate, see common.CtxWithPassThruHeaders
 }
 
 func (r *requestIdExtractor) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
-	ctx = r.TextMapPropagator.Extract(ctx, carrier)
-	if _, ok := common.TraceIdFromCtx(ctx); ok {
-		return ctx
+	ctx = common.CtxWithPassThruHeaders(r.TextMapPropagator.Extract(ctx, carrier), r.passThruHeaders)
+	if _, ok := common.TraceIdFromCtx(ctx); !ok {
+		if requestIds := metadata.ValueFromIncomingContext(ctx, common.HeaderXRequestId); len(requestIds) > 0 {
+			ctx = common.CtxWithTraceId(ctx, requestIds[0])
+		}
 	}
-	requestIds := metadata.ValueFromIncomingContext(ctx, common.HeaderXRequestId)
-	if len(requestIds) == 0 {
+	return r.extractDebug(ctx)
+}
+
+// extractDebug marks ctx as a debug call if the request carries a valid x-debug header, for observe.DebugSampler to
+// sample its spans.
+func (r *requestIdExtractor) extractDebug(ctx context.Context) context.Context {
+	tokens := metadata.ValueFromIncomingContext(ctx, common.HeaderXDebug)
+	if len(tokens) == 0 || !r.debug.Verify(tokens[0]) {
 		return ctx
 	}
-	return common.CtxWithTraceId(ctx, requestIds[0])
+	return common.CtxWithDebug(ctx, tokens[0])
 }
 
 type OtelServerHandler struct {
@@ -0,0 +1,136 @@
+package servertest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"google.golang.org/grpc/stats"
+)
+
+// LogEntry is a log recorded by LogRecorder.
+type LogEntry struct {
+	Level   string
+	Message string
+	Fields  klog.Fields
+}
+
+// LogRecorder is a klog.Logger recording logs in memory. Loggers derived with WithFields record into the same store.
+type LogRecorder struct {
+	store  *logStore
+	fields klog.Fields
+}
+
+type logStore struct {
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+var _ klog.Logger = (*LogRecorder)(nil)
+
+// NewLogRecorder returns an empty LogRecorder.
+func NewLogRecorder() *LogRecorder {
+	return &LogRecorder{store: &logStore{}}
+}
+
+// Entries returns the recorded logs in order.
+func (r *LogRecorder) Entries() []LogEntry {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return append([]LogEntry(nil), r.store.entries...)
+}
+
+// Reset drops the recorded logs.
+func (r *LogRecorder) Reset() {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.entries = nil
+}
+
+func (r *LogRecorder) log(level, msg string) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.entries = append(r.store.entries, LogEntry{Level: level, Message: msg, Fields: maps.Clone(r.fields)})
+}
+
+func (r *LogRecorder) Debug(msg string) {
+	r.log("debug", msg)
+}
+
+func (r *LogRecorder) Debugf(format string, args ...any) {
+	r.log("debug", fmt.Sprintf(format, args...))
+}
+
+func (r *LogRecorder) Info(msg string) {
+	r.log("info", msg)
+}
+
+func (r *LogRecorder) Infof(format string, args ...any) {
+	r.log("info", fmt.Sprintf(format, args...))
+}
+
+func (r *LogRecorder) Infoln(msg string) {
+	r.log("info", msg)
+}
+
+func (r *LogRecorder) Warn(msg string) {
+	r.log("warn", msg)
+}
+
+func (r *LogRecorder) Warnf(format string, args ...any) {
+	r.log("warn", fmt.Sprintf(format, args...))
+}
+
+func (r *LogRecorder) Error(msg string) {
+	r.log("error", msg)
+}
+
+func (r *LogRecorder) Errorf(format string, args ...any) {
+	r.log("error", fmt.Sprintf(format, args...))
+}
+
+func (r *LogRecorder) Fatal(msg string) {
+	r.log("fatal", msg)
+}
+
+func (r *LogRecorder) Fatalf(format string, args ...any) {
+	r.log("fatal", fmt.Sprintf(format, args...))
+}
+
+// WithFields returns a logger recording into the same store with the given fields added.
+func (r *LogRecorder) WithFields(keyValues klog.Fields) klog.Logger {
+	fields := maps.Clone(r.fields)
+	if fields == nil {
+		fields = make(klog.Fields, len(keyValues))
+	}
+	maps.Copy(fields, keyValues)
+	return &LogRecorder{store: r.store, fields: fields}
+}
+
+func (r *LogRecorder) GetDelegate() any {
+	return nil
+}
+
+func (r *LogRecorder) SetLogLevel(string) error {
+	return nil
+}
+
+// loggerInjector is a stats.Handler setting the logger of incoming calls' contexts to a LogRecorder, so that the logs
+// of all interceptors and handlers are recorded.
+type loggerInjector struct {
+	logs *LogRecorder
+}
+
+func (h loggerInjector) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return klog.CtxWithLogger(ctx, h.logs)
+}
+
+func (loggerInjector) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (loggerInjector) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (loggerInjector) HandleConn(context.Context, stats.ConnStats) {}
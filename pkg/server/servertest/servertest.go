@@ -0,0 +1,130 @@
+// Package servertest runs services in-process over bufconn with the same server setup as server.Serve, recording
+// logs, spans and metrics for tests to assert on.
+package servertest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/KyberNetwork/service-framework/pkg/client/grpcclient"
+	"github.com/KyberNetwork/service-framework/pkg/observe"
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric/kmetrictest"
+	"github.com/KyberNetwork/service-framework/pkg/server"
+	"github.com/KyberNetwork/service-framework/pkg/server/grpcserver"
+)
+
+const (
+	bufSize    = 1 << 20
+	grpcTarget = "passthrough:///bufconn"
+
+	// BaseURL is the base url of the http gateway to send requests to with Server.HTTP, followed by the configured
+	// BasePath.
+	BaseURL = "http://bufconn"
+)
+
+// Server is an in-process server started by Start.
+type Server struct {
+	*grpcserver.Server
+	HTTP  *http.Client            // http client sending requests to the http gateway, see BaseURL
+	Logs  *LogRecorder            // logs of the server, including those of interceptors and handlers
+	Spans *tracetest.SpanRecorder // spans of the server
+
+	grpcListener *bufconn.Listener
+	httpListener *bufconn.Listener
+	httpServer   *http.Server
+}
+
+// Start runs the services of cfg and opts with the same interceptors as server.Serve, serving grpc and the http
+// gateway over bufconn until the test finishes.
+func Start(t testing.TB, cfg grpcserver.Config, opts ...grpcserver.Opt) *Server {
+	t.Helper()
+	kmetrictest.EnsureMeterProvider()
+	s := &Server{
+		Logs:         NewLogRecorder(),
+		Spans:        tracetest.NewSpanRecorder(),
+		grpcListener: bufconn.Listen(bufSize),
+		httpListener: bufconn.Listen(bufSize),
+	}
+	opts = append(slices.Clip(opts),
+		grpcserver.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.Spans),
+			sdktrace.WithSampler(observe.DebugSampler(sdktrace.ParentBased(sdktrace.AlwaysSample()))))),
+		grpcserver.WithGatewayEndpoint(grpcTarget, grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(s.dialGRPC)),
+		grpcserver.WithGRPCServerOptions(grpc.StatsHandler(loggerInjector{logs: s.Logs})),
+	)
+	var err error
+	if s.Server, err = server.NewServer(klog.CtxWithLogger(context.Background(), s.Logs), cfg, opts...); err != nil {
+		t.Fatalf("servertest.Start: %v", err)
+	}
+
+	go func() {
+		_ = s.GRPCServer().Serve(s.grpcListener)
+	}()
+	s.httpServer = &http.Server{Handler: s.HTTPHandler()}
+	go func() {
+		_ = s.httpServer.Serve(s.httpListener)
+	}()
+	s.HTTP = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return s.httpListener.DialContext(ctx)
+		},
+	}}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *Server) dialGRPC(ctx context.Context, _ string) (net.Conn, error) {
+	return s.grpcListener.DialContext(ctx)
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.HTTP.CloseIdleConnections()
+	_ = s.httpServer.Close()
+	s.GRPCServer().Stop()
+}
+
+// NewClient creates a typed grpc client to s via grpcclient.New, with its default interceptors. The client is closed
+// when the test finishes.
+func NewClient[T any](t testing.TB, s *Server, clientFactory func(grpc.ClientConnInterface) T,
+	opts ...grpcclient.ApplyOption) T {
+	t.Helper()
+	opts = append(slices.Clip(opts), func(c *grpcclient.Config) {
+		c.BaseURL, c.Endpoints, c.PoolSize = grpcTarget, nil, 1
+		c.Insecure, c.GRPCCredentials = true, nil
+		c.DialOptions = append(slices.Clip(c.DialOptions), grpc.WithContextDialer(s.dialGRPC))
+	})
+	client, err := grpcclient.New(clientFactory, opts...)
+	if err != nil {
+		t.Fatalf("servertest.NewClient: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client.C
+}
+
+// Metrics collects the metrics recorded so far. As metrics are process-wide, they include those of other servers and
+// tests in the same process: compare values before and after the calls under test.
+func (s *Server) Metrics(t testing.TB) metricdata.ResourceMetrics {
+	t.Helper()
+	return kmetrictest.Collect(t)
+}
+
+// CounterValue returns the sum of the data points of the named int64 counter having all the given attributes.
+func (s *Server) CounterValue(t testing.TB, name string, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+	return kmetrictest.CounterValue(t, name, attrs...)
+}
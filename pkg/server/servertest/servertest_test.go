@@ -0,0 +1,238 @@
+package servertest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/kutils/klog"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/KyberNetwork/service-framework/pkg/common"
+	"github.com/KyberNetwork/service-framework/pkg/observe/kmetric"
+	"github.com/KyberNetwork/service-framework/pkg/server/grpcserver"
+	"github.com/KyberNetwork/service-framework/pkg/server/middleware/trace"
+)
+
+const echoMethod = "/test.Echo/Echo"
+
+type echoServer struct{}
+
+func (echoServer) Echo(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	klog.Infof(ctx, "echo %s", req.Value)
+	switch req.Value {
+	case "missing":
+		return nil, status.Error(codes.NotFound, "not found")
+	case "boom":
+		return nil, errors.New("boom")
+	default:
+		return req, nil
+	}
+}
+
+var echoServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Echo",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any,
+			error) {
+			req := new(wrapperspb.StringValue)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: echoMethod},
+				func(ctx context.Context, req any) (any, error) {
+					return srv.(echoServer).Echo(ctx, req.(*wrapperspb.StringValue))
+				})
+		},
+	}},
+}
+
+type echoClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func (c echoClient) Echo(ctx context.Context, req *wrapperspb.StringValue, opts ...grpc.CallOption) (
+	*wrapperspb.StringValue, error) {
+	resp := new(wrapperspb.StringValue)
+	return resp, c.cc.Invoke(ctx, echoMethod, req, resp, opts...)
+}
+
+// registerEchoHandlerFromEndpoint mimics the handler registration generated by grpc-gateway.
+func registerEchoHandlerFromEndpoint(_ context.Context, mux *runtime.ServeMux, endpoint string,
+	opts []grpc.DialOption) error {
+	conn, err := grpc.NewClient(endpoint, opts...)
+	if err != nil {
+		return err
+	}
+	client := echoClient{cc: conn}
+	return mux.HandlePath(http.MethodGet, "/echo/{value}",
+		func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			_, outboundMarshaler := runtime.MarshalerForRequest(mux, r)
+			ctx, err := runtime.AnnotateContext(r.Context(), mux, r, echoMethod,
+				runtime.WithHTTPPathPattern("/echo/{value}"))
+			if err != nil {
+				runtime.HTTPError(ctx, mux, outboundMarshaler, w, r, err)
+				return
+			}
+			var md runtime.ServerMetadata
+			resp, err := client.Echo(ctx, wrapperspb.String(pathParams["value"]), grpc.Header(&md.HeaderMD),
+				grpc.Trailer(&md.TrailerMD))
+			ctx = runtime.NewServerMetadataContext(ctx, md)
+			if err != nil {
+				runtime.HTTPError(ctx, mux, outboundMarshaler, w, r, err)
+				return
+			}
+			runtime.ForwardResponseMessage(ctx, mux, outboundMarshaler, w, r, resp)
+		})
+}
+
+func startEcho(t *testing.T) (*Server, echoClient) {
+	return startEchoWithCfg(t, grpcserver.Config{Mode: grpcserver.Production})
+}
+
+func startEchoWithCfg(t *testing.T, cfg grpcserver.Config) (*Server, echoClient) {
+	s := Start(t, cfg, grpcserver.NewService(echoServer{},
+		func(s grpc.ServiceRegistrar, srv echoServer) { s.RegisterService(&echoServiceDesc, srv) },
+		registerEchoHandlerFromEndpoint))
+	return s, NewClient(t, s, func(cc grpc.ClientConnInterface) echoClient { return echoClient{cc: cc} })
+}
+
+func TestServerGrpc(t *testing.T) {
+	s, client := startEcho(t)
+
+	var header metadata.MD
+	resp, err := client.Echo(context.Background(), wrapperspb.String("hello"), grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.Value)
+
+	traceIds := header.Get(common.HeaderXTraceId)
+	require.Len(t, traceIds, 1)
+	var handlerLog *LogEntry
+	for _, entry := range s.Logs.Entries() {
+		if entry.Message == "echo hello" {
+			handlerLog = &entry
+		}
+	}
+	require.NotNil(t, handlerLog, "handler logs are recorded")
+	assert.Equal(t, traceIds[0], handlerLog.Fields[common.LogFieldTraceId])
+
+	spans := s.Spans.Ended()
+	require.NotEmpty(t, spans)
+	assert.Equal(t, traceIds[0], spans[len(spans)-1].SpanContext().TraceID().String())
+}
+
+func TestServerErrorMapping(t *testing.T) {
+	s, client := startEcho(t)
+	notFoundAttr := attribute.String(kmetric.AttrCode, codes.NotFound.String())
+	notFoundCount := s.CounterValue(t, kmetric.IncomingRequest, notFoundAttr)
+
+	_, err := client.Echo(context.Background(), wrapperspb.String("missing"))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, notFoundCount+1, s.CounterValue(t, kmetric.IncomingRequest, notFoundAttr))
+
+	_, err = client.Echo(context.Background(), wrapperspb.String("boom"))
+	st := status.Convert(err)
+	assert.Equal(t, codes.Internal, st.Code())
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError), st.Message(), "raw error is hidden in production")
+	require.Len(t, st.Details(), 1)
+	requestId := st.Details()[0].(*structpb.Struct).Fields[trace.FieldNameRequestId].GetStringValue()
+	assert.NotEmpty(t, requestId, "request_id is injected into error details")
+}
+
+func TestServerHttp(t *testing.T) {
+	s, _ := startEcho(t)
+
+	resp, err := s.HTTP.Get(BaseURL + "/echo/hello")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get(common.HeaderXTraceId))
+
+	resp, err = s.HTTP.Get(BaseURL + "/echo/missing")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServerDebug(t *testing.T) {
+	cfg := grpcserver.Config{Mode: grpcserver.Production}
+	cfg.Debug.Secret, cfg.Debug.Tokens = "secret", []string{"static"}
+	cfg.Log.IgnoreReq = []string{echoMethod}
+	s, client := startEchoWithCfg(t, cfg)
+
+	unsampledParent := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID: oteltrace.TraceID{1}, SpanID: oteltrace.SpanID{1}, Remote: true})
+	for _, tc := range []struct {
+		name  string
+		md    metadata.MD
+		debug bool
+	}{
+		{name: "no token", md: metadata.Pairs()},
+		{name: "invalid token", md: metadata.Pairs(common.HeaderXDebug, "1")},
+		{name: "spoofed client id", md: metadata.Pairs(common.HeaderXDebug, "1", common.HeaderXClientId, "admin")},
+		{name: "expired token", md: metadata.Pairs(common.HeaderXDebug,
+			common.SignDebugToken(cfg.Debug.Secret, time.Now().Add(-time.Minute)))},
+		{name: "static token", md: metadata.Pairs(common.HeaderXDebug, "static"), debug: true},
+		{name: "signed token", md: metadata.Pairs(common.HeaderXDebug,
+			common.SignDebugToken(cfg.Debug.Secret, time.Now().Add(time.Minute))), debug: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s.Logs.Reset()
+			s.Spans.Reset()
+			ctx := oteltrace.ContextWithRemoteSpanContext(context.Background(), unsampledParent)
+			ctx = metadata.NewOutgoingContext(ctx, tc.md)
+			_, err := client.Echo(ctx, wrapperspb.String("hello"))
+			require.NoError(t, err)
+
+			var sampled bool
+			for _, span := range s.Spans.Ended() {
+				sampled = sampled || span.SpanContext().TraceID() == unsampledParent.TraceID()
+			}
+			assert.Equal(t, tc.debug, sampled, "debug calls are sampled despite an unsampled parent")
+
+			var reqLog string
+			for _, entry := range s.Logs.Entries() {
+				if strings.HasPrefix(entry.Message, "cmd="+echoMethod) {
+					reqLog = entry.Message
+				}
+			}
+			assert.Equal(t, tc.debug, strings.Contains(reqLog, `req=value:"hello"`), "debug calls log ignored requests: %s",
+				reqLog)
+		})
+	}
+}
+
+func TestServerHealthCheck(t *testing.T) {
+	var healthErr error
+	common.RegisterHealthCheck("test.health", func(context.Context) error { return healthErr })
+	s, _ := startEcho(t)
+	healthClient := NewClient(t, s, healthv1.NewHealthClient)
+
+	resp, err := healthClient.Check(context.Background(), &healthv1.HealthCheckRequest{Service: "test.health"})
+	require.NoError(t, err)
+	assert.Equal(t, healthv1.HealthCheckResponse_SERVING, resp.Status)
+
+	healthErr = errors.New("unhealthy")
+	resp, err = healthClient.Check(context.Background(), &healthv1.HealthCheckRequest{Service: "test.health"})
+	require.NoError(t, err)
+	assert.Equal(t, healthv1.HealthCheckResponse_NOT_SERVING, resp.Status)
+	resp, err = healthClient.Check(context.Background(), &healthv1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthv1.HealthCheckResponse_SERVING, resp.Status, "overall health is not affected")
+}